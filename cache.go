@@ -0,0 +1,74 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package csitranslation
+
+import (
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/cache"
+)
+
+// translationCacheTTL is how long a translation stays cached. Entries are
+// invalidated as soon as the resourceVersion of their PV changes, the TTL only
+// releases PVs that are not translated anymore, e.g. because they were deleted.
+const translationCacheTTL = time.Hour
+
+// translationCache is a LRU cache of PV translations keyed by PV UID
+type translationCache struct {
+	lru *cache.LRUExpireCache
+}
+
+// cachedTranslation is the translation of a PV at a given resourceVersion
+type cachedTranslation struct {
+	resourceVersion string
+	pv              *v1.PersistentVolume
+}
+
+func newTranslationCache(size int) *translationCache {
+	return &translationCache{lru: cache.NewLRUExpireCache(size)}
+}
+
+// get returns a copy of the cached translation of pv. PVs without UID or
+// resourceVersion are never cached.
+func (c *translationCache) get(pv *v1.PersistentVolume) (*v1.PersistentVolume, bool) {
+	if c == nil || pv.UID == "" || pv.ResourceVersion == "" {
+		return nil, false
+	}
+	obj, ok := c.lru.Get(pv.UID)
+	if !ok {
+		return nil, false
+	}
+	entry := obj.(cachedTranslation)
+	if entry.resourceVersion != pv.ResourceVersion {
+		// the PV changed since it was translated
+		c.lru.Remove(pv.UID)
+		return nil, false
+	}
+	return entry.pv.DeepCopy(), true
+}
+
+// add caches a copy of translatedPV as the translation of pv
+func (c *translationCache) add(pv, translatedPV *v1.PersistentVolume) {
+	if c == nil || pv.UID == "" || pv.ResourceVersion == "" {
+		return
+	}
+	c.lru.Add(pv.UID, cachedTranslation{
+		resourceVersion: pv.ResourceVersion,
+		pv:              translatedPV.DeepCopy(),
+	}, translationCacheTTL)
+}
@@ -0,0 +1,193 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package csitranslation
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/csi-translation-lib/plugins"
+)
+
+func makeCacheablePV(uid, resourceVersion string) *v1.PersistentVolume {
+	pv := makeGCEPDPV(kubernetesGATopologyLabels, makeTopology(v1.LabelTopologyZone, "us-east-1a"))
+	pv.Name = "pv-" + uid
+	pv.UID = types.UID(uid)
+	pv.ResourceVersion = resourceVersion
+	return pv
+}
+
+func newCachingTranslator(tb testing.TB, size int) CSITranslator {
+	ctl, err := NewWithOptions(WithTranslationCache(size))
+	if err != nil {
+		tb.Fatalf("Error when creating translator: %v", err)
+	}
+	return ctl
+}
+
+func TestTranslationCache(t *testing.T) {
+	ctl := newCachingTranslator(t, 2)
+
+	pv := makeCacheablePV("uid1", "1")
+	first, err := ctl.TranslateInTreePVToCSI(pv)
+	if err != nil {
+		t.Fatalf("Error when translating to CSI: %v", err)
+	}
+	// Modify the result, the cache must hand out copies
+	first.Spec.CSI.VolumeHandle = "modified"
+
+	second, err := ctl.TranslateInTreePVToCSI(pv)
+	if err != nil {
+		t.Fatalf("Error when translating to CSI: %v", err)
+	}
+	uncached, err := New().TranslateInTreePVToCSI(pv)
+	if err != nil {
+		t.Fatalf("Error when translating to CSI: %v", err)
+	}
+	if !reflect.DeepEqual(second, uncached) {
+		t.Errorf("Cached translation not equal to uncached one:\n\nCached: %#v\n\nUncached: %#v", second, uncached)
+	}
+
+	// A new resourceVersion must invalidate the cached translation
+	updatedPV := makeCacheablePV("uid1", "2")
+	updatedPV.Spec.GCEPersistentDisk.PDName = "updated-disk"
+	updated, err := ctl.TranslateInTreePVToCSI(updatedPV)
+	if err != nil {
+		t.Fatalf("Error when translating to CSI: %v", err)
+	}
+	if updated.Spec.CSI.VolumeHandle == second.Spec.CSI.VolumeHandle {
+		t.Errorf("Expected translation of updated PV, got cached volume handle %s", updated.Spec.CSI.VolumeHandle)
+	}
+}
+
+func TestTranslationCacheSkipsUncacheablePVs(t *testing.T) {
+	ctl := newCachingTranslator(t, 2)
+
+	pv := makeCacheablePV("", "")
+	if _, err := ctl.TranslateInTreePVToCSI(pv); err != nil {
+		t.Fatalf("Error when translating to CSI: %v", err)
+	}
+	if keys := ctl.cache.lru.Keys(); len(keys) != 0 {
+		t.Errorf("Expected PV without UID not to be cached, got keys: %v", keys)
+	}
+
+	// Errors are not cached
+	pv = makeCacheablePV("uid1", "1")
+	pv.Spec.GCEPersistentDisk = nil
+	pv.Spec.AWSElasticBlockStore = &v1.AWSElasticBlockStoreVolumeSource{VolumeID: "aws://us-east-1a/invalid"}
+	if _, err := ctl.TranslateInTreePVToCSI(pv); err == nil {
+		t.Errorf("Expected error, but did not get one.")
+	}
+	if keys := ctl.cache.lru.Keys(); len(keys) != 0 {
+		t.Errorf("Expected failed translation not to be cached, got keys: %v", keys)
+	}
+}
+
+func TestTranslationCacheEviction(t *testing.T) {
+	ctl := newCachingTranslator(t, 1)
+
+	for _, uid := range []string{"uid1", "uid2"} {
+		if _, err := ctl.TranslateInTreePVToCSI(makeCacheablePV(uid, "1")); err != nil {
+			t.Fatalf("Error when translating to CSI: %v", err)
+		}
+	}
+	keys := ctl.cache.lru.Keys()
+	if len(keys) != 1 || keys[0] != types.UID("uid2") {
+		t.Errorf("Expected only the most recent translation to be cached, got keys: %v", keys)
+	}
+}
+
+func TestTranslationCacheDisabled(t *testing.T) {
+	if ctl := newCachingTranslator(t, 0); ctl.cache != nil {
+		t.Errorf("Expected cache to be disabled for size 0")
+	}
+}
+
+// makeBenchmarkPV returns a PV shaped like the ones found in clusters: a
+// regional disk with zone labels, node affinity on multiple topology keys,
+// a bound claim and the annotations and mount options set by provisioners
+func makeBenchmarkPV() *v1.PersistentVolume {
+	pv := makeGCEPDPV(map[string]string{
+		v1.LabelFailureDomainBetaZone:   "us-central1-a__us-central1-c",
+		v1.LabelFailureDomainBetaRegion: "us-central1",
+	}, nil)
+	pv.Name = "pvc-8a7b5c3e-1f2d-4e6a-9b8c-0d1e2f3a4b5c"
+	pv.UID = types.UID("1f0c5f5e-8a0b-4c63-9f3b-2a8d6f1e4b7c")
+	pv.ResourceVersion = "184467"
+	pv.Spec.GCEPersistentDisk.PDName = "pvc-8a7b5c3e-1f2d-4e6a-9b8c-0d1e2f3a4b5c"
+	pv.Spec.GCEPersistentDisk.FSType = "ext4"
+	pv.Annotations = map[string]string{
+		"kubernetes.io/createdby":                                    "gce-pd-dynamic-provisioner",
+		"pv.kubernetes.io/bound-by-controller":                       "yes",
+		"pv.kubernetes.io/provisioned-by":                            plugins.GCEPDInTreePluginName,
+		"volume.kubernetes.io/provisioner-deletion-secret-name":      "",
+		"volume.kubernetes.io/provisioner-deletion-secret-namespace": "",
+	}
+	pv.Finalizers = []string{"kubernetes.io/pv-protection"}
+	pv.Spec.Capacity = v1.ResourceList{v1.ResourceStorage: resource.MustParse("200Gi")}
+	pv.Spec.AccessModes = []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce}
+	pv.Spec.ClaimRef = &v1.ObjectReference{
+		Kind:            "PersistentVolumeClaim",
+		Namespace:       "default",
+		Name:            "data-postgres-0",
+		UID:             types.UID("8a7b5c3e-1f2d-4e6a-9b8c-0d1e2f3a4b5c"),
+		APIVersion:      "v1",
+		ResourceVersion: "184460",
+	}
+	pv.Spec.PersistentVolumeReclaimPolicy = v1.PersistentVolumeReclaimDelete
+	pv.Spec.StorageClassName = "regional-ssd"
+	pv.Spec.MountOptions = []string{"noatime", "nodiratime", "discard"}
+	pv.Spec.NodeAffinity = &v1.VolumeNodeAffinity{
+		Required: &v1.NodeSelector{
+			NodeSelectorTerms: []v1.NodeSelectorTerm{
+				{
+					MatchExpressions: []v1.NodeSelectorRequirement{
+						{Key: v1.LabelFailureDomainBetaZone, Operator: v1.NodeSelectorOpIn, Values: []string{"us-central1-a", "us-central1-c"}},
+						{Key: v1.LabelFailureDomainBetaRegion, Operator: v1.NodeSelectorOpIn, Values: []string{"us-central1"}},
+						{Key: v1.LabelOSStable, Operator: v1.NodeSelectorOpIn, Values: []string{"linux"}},
+					},
+				},
+			},
+		},
+	}
+	return pv
+}
+
+func benchmarkTranslateInTreePVToCSI(b *testing.B, ctl CSITranslator, pv *v1.PersistentVolume) {
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		csiPV, err := ctl.TranslateInTreePVToCSI(pv)
+		if err != nil {
+			b.Fatalf("Error when translating to CSI: %v", err)
+		}
+		if csiPV.Spec.CSI.Driver != plugins.GCEPDDriverName {
+			b.Fatalf("Unexpected driver %s", csiPV.Spec.CSI.Driver)
+		}
+	}
+}
+
+func BenchmarkTranslateInTreePVToCSI(b *testing.B) {
+	benchmarkTranslateInTreePVToCSI(b, New(), makeBenchmarkPV())
+}
+
+func BenchmarkTranslateInTreePVToCSICached(b *testing.B) {
+	benchmarkTranslateInTreePVToCSI(b, newCachingTranslator(b, 128), makeBenchmarkPV())
+}
@@ -0,0 +1,438 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package csitranslation
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	storage "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/csi-translation-lib/plugins"
+)
+
+const (
+	conformanceGlusterfsDriverName = "glusterfs.csi.example.com"
+	conformanceFlexDriverName      = "example/lvm"
+	conformanceFlexCSIDriverName   = "lvm.csi.example.com"
+	conformanceZone                = "us-east-1a"
+)
+
+// conformanceFixture holds the in-tree objects a plugin is exercised with by
+// TestPluginConformance. Whether the plugin supports them is probed, not
+// declared.
+type conformanceFixture struct {
+	inline       *v1.Volume
+	pv           *v1.PersistentVolume
+	storageClass *storage.StorageClass
+	// topologyKey is the CSI topology key zone labels of pv are expected to
+	// be translated to, if the plugin translates topology
+	topologyKey string
+	// roundTripSource is the source pv is expected to have after translating
+	// it to CSI and back, if the plugin normalizes it. Defaults to the source
+	// of pv.
+	roundTripSource *v1.PersistentVolumeSource
+}
+
+// conformanceFixtures returns the fixtures of all registered plugins keyed by
+// CSI driver name. Every plugin must have one.
+func conformanceFixtures() map[string]conformanceFixture {
+	secretNamespace := "default"
+	emptyString := ""
+	readOnly := false
+	managedKind := v1.AzureManagedDisk
+	return map[string]conformanceFixture{
+		plugins.GCEPDDriverName: {
+			inline:       &v1.Volume{VolumeSource: v1.VolumeSource{GCEPersistentDisk: &v1.GCEPersistentDiskVolumeSource{PDName: "test-disk"}}},
+			pv:           makeConformancePV(v1.PersistentVolumeSource{GCEPersistentDisk: &v1.GCEPersistentDiskVolumeSource{PDName: "test-disk"}}),
+			storageClass: &storage.StorageClass{Parameters: map[string]string{"type": "pd-ssd"}},
+			topologyKey:  plugins.GCEPDTopologyKey,
+		},
+		plugins.AWSEBSDriverName: {
+			inline:       &v1.Volume{VolumeSource: v1.VolumeSource{AWSElasticBlockStore: &v1.AWSElasticBlockStoreVolumeSource{VolumeID: "vol-0123456789abcdef0"}}},
+			pv:           makeConformancePV(v1.PersistentVolumeSource{AWSElasticBlockStore: &v1.AWSElasticBlockStoreVolumeSource{VolumeID: "aws://us-east-1a/vol-0123456789abcdef0"}}),
+			storageClass: &storage.StorageClass{Parameters: map[string]string{"type": "gp2"}},
+			topologyKey:  plugins.AWSEBSTopologyKey,
+			// the zone is dropped from the volume ID
+			roundTripSource: &v1.PersistentVolumeSource{AWSElasticBlockStore: &v1.AWSElasticBlockStoreVolumeSource{VolumeID: "vol-0123456789abcdef0"}},
+		},
+		plugins.CinderDriverName: {
+			inline:       &v1.Volume{VolumeSource: v1.VolumeSource{Cinder: &v1.CinderVolumeSource{VolumeID: "cinder-volume"}}},
+			pv:           makeConformancePV(v1.PersistentVolumeSource{Cinder: &v1.CinderPersistentVolumeSource{VolumeID: "cinder-volume"}}),
+			storageClass: &storage.StorageClass{Parameters: map[string]string{"availability": "nova"}},
+			topologyKey:  plugins.CinderTopologyKey,
+		},
+		plugins.AzureDiskDriverName: {
+			inline: &v1.Volume{VolumeSource: v1.VolumeSource{AzureDisk: &v1.AzureDiskVolumeSource{
+				DiskName:    "disk",
+				DataDiskURI: "/subscriptions/12/resourceGroups/23/providers/Microsoft.Compute/disks/disk",
+			}}},
+			pv: makeConformancePV(v1.PersistentVolumeSource{AzureDisk: &v1.AzureDiskVolumeSource{
+				DiskName:    "disk",
+				DataDiskURI: "/subscriptions/12/resourceGroups/23/providers/Microsoft.Compute/disks/disk",
+			}}),
+			storageClass: &storage.StorageClass{Parameters: map[string]string{"skuName": "Premium_LRS"}},
+			// defaults are filled in
+			roundTripSource: &v1.PersistentVolumeSource{AzureDisk: &v1.AzureDiskVolumeSource{
+				DiskName:    "disk",
+				DataDiskURI: "/subscriptions/12/resourceGroups/23/providers/Microsoft.Compute/disks/disk",
+				FSType:      &emptyString,
+				ReadOnly:    &readOnly,
+				Kind:        &managedKind,
+			}},
+		},
+		plugins.AzureFileDriverName: {
+			inline: &v1.Volume{VolumeSource: v1.VolumeSource{AzureFile: &v1.AzureFileVolumeSource{
+				SecretName: "azure-storage-account-st-secret",
+				ShareName:  "share",
+			}}},
+			pv: makeConformancePV(v1.PersistentVolumeSource{AzureFile: &v1.AzureFilePersistentVolumeSource{
+				SecretName:      "azure-storage-account-st-secret",
+				SecretNamespace: &secretNamespace,
+				ShareName:       "share",
+			}}),
+			storageClass: &storage.StorageClass{Parameters: map[string]string{"skuName": "Standard_LRS"}},
+		},
+		plugins.VSphereDriverName: {
+			inline:       &v1.Volume{VolumeSource: v1.VolumeSource{VsphereVolume: &v1.VsphereVirtualDiskVolumeSource{VolumePath: "[vsanDatastore] kubevols/disk.vmdk"}}},
+			pv:           makeConformancePV(v1.PersistentVolumeSource{VsphereVolume: &v1.VsphereVirtualDiskVolumeSource{VolumePath: "[vsanDatastore] kubevols/disk.vmdk"}}),
+			storageClass: &storage.StorageClass{Parameters: map[string]string{"diskformat": "thin"}},
+			// the path is only recovered for volumes provisioned by the in-tree plugin
+			roundTripSource: &v1.PersistentVolumeSource{VsphereVolume: &v1.VsphereVirtualDiskVolumeSource{}},
+		},
+		plugins.PortworxDriverName: {
+			inline:       &v1.Volume{VolumeSource: v1.VolumeSource{PortworxVolume: &v1.PortworxVolumeSource{VolumeID: "pxd-volume"}}},
+			pv:           makeConformancePV(v1.PersistentVolumeSource{PortworxVolume: &v1.PortworxVolumeSource{VolumeID: "pxd-volume"}}),
+			storageClass: &storage.StorageClass{Parameters: map[string]string{"repl": "1"}},
+		},
+		plugins.RBDDriverName: {
+			inline: &v1.Volume{VolumeSource: v1.VolumeSource{RBD: &v1.RBDVolumeSource{
+				CephMonitors: []string{"10.70.53.126:6789"},
+				RBDImage:     "image",
+				SecretRef:    &v1.LocalObjectReference{Name: "ceph-secret"},
+			}}},
+			pv: makeConformancePV(v1.PersistentVolumeSource{RBD: &v1.RBDPersistentVolumeSource{
+				CephMonitors: []string{"10.70.53.126:6789"},
+				RBDPool:      "replicapool",
+				RBDImage:     "kubernetes-dynamic-pvc-e4111eb6-4088-11ec-b823-0242ac110003",
+				SecretRef:    &v1.SecretReference{Name: "ceph-secret", Namespace: "default"},
+			}}),
+			storageClass: &storage.StorageClass{Parameters: map[string]string{
+				"monitors":        "10.70.53.126:6789",
+				"adminSecretName": "ceph-secret",
+			}},
+			// monitors are resolved by the CSI driver from its cluster ID
+			roundTripSource: &v1.PersistentVolumeSource{RBD: &v1.RBDPersistentVolumeSource{
+				CephMonitors: []string{""},
+				RBDPool:      "replicapool",
+				RBDImage:     "kubernetes-dynamic-pvc-e4111eb6-4088-11ec-b823-0242ac110003",
+				RadosUser:    "admin",
+				SecretRef:    &v1.SecretReference{Name: "ceph-secret", Namespace: "default"},
+			}},
+		},
+		conformanceGlusterfsDriverName: {
+			inline: &v1.Volume{VolumeSource: v1.VolumeSource{Glusterfs: &v1.GlusterfsVolumeSource{
+				EndpointsName: "glusterfs-cluster",
+				Path:          "kube_vol",
+			}}},
+			pv: makeConformancePV(v1.PersistentVolumeSource{Glusterfs: &v1.GlusterfsPersistentVolumeSource{
+				EndpointsName: "glusterfs-cluster",
+				Path:          "kube_vol",
+			}}),
+			storageClass: &storage.StorageClass{Parameters: map[string]string{"resturl": "http://heketi:8080"}},
+		},
+		conformanceFlexCSIDriverName: {
+			inline: &v1.Volume{VolumeSource: v1.VolumeSource{FlexVolume: &v1.FlexVolumeSource{
+				Driver:    conformanceFlexDriverName,
+				SecretRef: &v1.LocalObjectReference{Name: "lvm-secret"},
+				Options:   map[string]string{"volumeID": "vg0/lv0"},
+			}}},
+			pv: makeConformancePV(v1.PersistentVolumeSource{FlexVolume: &v1.FlexPersistentVolumeSource{
+				Driver:    conformanceFlexDriverName,
+				SecretRef: &v1.SecretReference{Name: "lvm-secret", Namespace: "default"},
+				Options:   map[string]string{"volumeID": "vg0/lv0"},
+			}}),
+			storageClass: &storage.StorageClass{Parameters: map[string]string{"size": "1G"}},
+		},
+	}
+}
+
+func makeConformancePV(source v1.PersistentVolumeSource) *v1.PersistentVolume {
+	return &v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "conformance-pv",
+		},
+		Spec: v1.PersistentVolumeSpec{
+			PersistentVolumeSource: source,
+			AccessModes:            []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce},
+		},
+	}
+}
+
+// errNotTranslated is returned by probes of capabilities a plugin silently
+// does not translate, as opposed to rejecting them with a typed error
+var errNotTranslated = errors.New("not translated")
+
+// isUnsupportedError tests whether err is one of the typed errors plugins
+// report unsupported volumes and storage classes with
+func isUnsupportedError(err error) bool {
+	var (
+		noCSIErr       *plugins.ErrNoCSIEquivalent
+		blockErr       *plugins.ErrBlockVolumeNotSupported
+		scErr          *plugins.ErrStorageClassNotSupported
+		unsupportedErr *plugins.ErrUnsupportedParameters
+	)
+	return errors.As(err, &noCSIErr) || errors.As(err, &blockErr) || errors.As(err, &scErr) || errors.As(err, &unsupportedErr)
+}
+
+// conformanceProbes is the matrix every registered plugin is exercised with.
+// A probe returns nil if the plugin supports the capability, the typed error
+// it rejected the capability with or errNotTranslated. Translations that
+// succeed but are wrong, or fail with an untyped error, fail the test.
+var conformanceProbes = []struct {
+	name  string
+	probe func(t *testing.T, ctl CSITranslator, driverName string, plugin plugins.InTreePlugin, f conformanceFixture) error
+}{
+	{
+		name: "inline",
+		probe: func(t *testing.T, ctl CSITranslator, driverName string, plugin plugins.InTreePlugin, f conformanceFixture) error {
+			if !plugin.CanSupportInline(f.inline) {
+				t.Fatalf("Plugin does not support its inline volume")
+			}
+			original := f.inline.DeepCopy()
+			pv, err := ctl.TranslateInTreeInlineVolumeToCSI(f.inline, "default")
+			if !reflect.DeepEqual(f.inline, original) {
+				t.Errorf("Input volume was modified")
+			}
+			if err != nil {
+				return err
+			}
+			if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != driverName {
+				t.Errorf("Expected CSI source of driver %s, got: %#v", driverName, pv.Spec.CSI)
+			}
+			if pv.Spec.VolumeMode == nil {
+				t.Errorf("Expected volume mode to be set")
+			}
+			return nil
+		},
+	},
+	{
+		name: "pv",
+		probe: func(t *testing.T, ctl CSITranslator, driverName string, plugin plugins.InTreePlugin, f conformanceFixture) error {
+			original := f.pv.DeepCopy()
+			pv, err := ctl.TranslateInTreePVToCSI(f.pv)
+			if !reflect.DeepEqual(f.pv, original) {
+				t.Errorf("Input PV was modified")
+			}
+			if err != nil {
+				return err
+			}
+			if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != driverName || pv.Spec.CSI.VolumeHandle == "" {
+				t.Errorf("Expected CSI source of driver %s with volume handle, got: %#v", driverName, pv.Spec.CSI)
+			}
+			if plugin.CanSupport(pv) {
+				t.Errorf("Expected in-tree source to be removed from translated PV")
+			}
+			if pv.Name != original.Name {
+				t.Errorf("Expected PV name %s to be preserved, got %s", original.Name, pv.Name)
+			}
+			return nil
+		},
+	},
+	{
+		name: "storageClass",
+		probe: func(t *testing.T, ctl CSITranslator, driverName string, plugin plugins.InTreePlugin, f conformanceFixture) error {
+			allowVolumeExpansion := true
+			sc := f.storageClass.DeepCopy()
+			sc.Name = "conformance-sc"
+			sc.Provisioner = plugin.GetInTreePluginName()
+			sc.AllowVolumeExpansion = &allowVolumeExpansion
+			original := sc.DeepCopy()
+			csiSC, err := ctl.TranslateInTreeStorageClassToCSI(plugin.GetInTreePluginName(), sc)
+			if !reflect.DeepEqual(sc, original) {
+				t.Errorf("Input storage class was modified")
+			}
+			if err != nil {
+				return err
+			}
+			if csiSC.Name != original.Name {
+				t.Errorf("Expected storage class name %s to be preserved, got %s", original.Name, csiSC.Name)
+			}
+			if csiSC.AllowVolumeExpansion == nil || !*csiSC.AllowVolumeExpansion {
+				t.Errorf("Expected allowVolumeExpansion to be preserved")
+			}
+			return nil
+		},
+	},
+	{
+		name: "topology",
+		probe: func(t *testing.T, ctl CSITranslator, driverName string, plugin plugins.InTreePlugin, f conformanceFixture) error {
+			pv := f.pv.DeepCopy()
+			pv.Labels = map[string]string{v1.LabelTopologyZone: conformanceZone}
+			csiPV, err := ctl.TranslateInTreePVToCSI(pv)
+			if err != nil {
+				return err
+			}
+			if csiPV.Spec.NodeAffinity == nil {
+				return errNotTranslated
+			}
+			if f.topologyKey == "" || !plugins.TopologyKeyExist(f.topologyKey, csiPV.Spec.NodeAffinity) {
+				t.Errorf("Expected topology key %q in node affinity, got: %v", f.topologyKey, csiPV.Spec.NodeAffinity)
+			}
+			inTreePV, err := ctl.TranslateCSIPVToInTree(csiPV)
+			if err != nil {
+				t.Fatalf("Error when translating PV to in-tree: %v", err)
+			}
+			if !plugins.TopologyKeyExist(v1.LabelTopologyZone, inTreePV.Spec.NodeAffinity) {
+				t.Errorf("Expected topology key %s in node affinity, got: %v", v1.LabelTopologyZone, inTreePV.Spec.NodeAffinity)
+			}
+			return nil
+		},
+	},
+	{
+		name: "secrets",
+		probe: func(t *testing.T, ctl CSITranslator, driverName string, plugin plugins.InTreePlugin, f conformanceFixture) error {
+			pv, err := ctl.TranslateInTreePVToCSI(f.pv)
+			if err != nil {
+				return err
+			}
+			for _, ref := range []*v1.SecretReference{pv.Spec.CSI.NodeStageSecretRef, pv.Spec.CSI.NodePublishSecretRef} {
+				if ref != nil {
+					if ref.Name == "" || ref.Namespace == "" {
+						t.Errorf("Expected secret reference with name and namespace, got: %#v", ref)
+					}
+					return nil
+				}
+			}
+			return errNotTranslated
+		},
+	},
+	{
+		name: "block",
+		probe: func(t *testing.T, ctl CSITranslator, driverName string, plugin plugins.InTreePlugin, f conformanceFixture) error {
+			pv := f.pv.DeepCopy()
+			volumeMode := v1.PersistentVolumeBlock
+			pv.Spec.VolumeMode = &volumeMode
+			csiPV, err := ctl.TranslateInTreePVToCSI(pv)
+			if err != nil {
+				return err
+			}
+			if csiPV.Spec.VolumeMode == nil || *csiPV.Spec.VolumeMode != v1.PersistentVolumeBlock {
+				t.Errorf("Expected Block volume mode to be preserved, got: %v", csiPV.Spec.VolumeMode)
+			}
+			inTreePV, err := ctl.TranslateCSIPVToInTree(csiPV)
+			if err != nil {
+				t.Fatalf("Error when translating PV to in-tree: %v", err)
+			}
+			if inTreePV.Spec.VolumeMode == nil || *inTreePV.Spec.VolumeMode != v1.PersistentVolumeBlock {
+				t.Errorf("Expected Block volume mode to be preserved, got: %v", inTreePV.Spec.VolumeMode)
+			}
+			return nil
+		},
+	},
+	{
+		name: "reverse",
+		probe: func(t *testing.T, ctl CSITranslator, driverName string, plugin plugins.InTreePlugin, f conformanceFixture) error {
+			csiPV, err := ctl.TranslateInTreePVToCSI(f.pv)
+			if err != nil {
+				return err
+			}
+			original := csiPV.DeepCopy()
+			inTreePV, err := ctl.TranslateCSIPVToInTree(csiPV)
+			if !reflect.DeepEqual(csiPV, original) {
+				t.Errorf("Input PV was modified")
+			}
+			if err != nil {
+				return err
+			}
+			expSource := f.pv.Spec.PersistentVolumeSource
+			if f.roundTripSource != nil {
+				expSource = *f.roundTripSource
+			}
+			if !reflect.DeepEqual(inTreePV.Spec.PersistentVolumeSource, expSource) {
+				t.Errorf("Source after translation and back not equal:\n\nOriginal: %v\n\nRound-trip: %v", expSource.String(), inTreePV.Spec.PersistentVolumeSource.String())
+			}
+			return nil
+		},
+	},
+}
+
+// TestPluginConformance exercises every registered plugin, including the
+// ones enabled by options, with the conformance matrix and logs the
+// capabilities each of them supports.
+func TestPluginConformance(t *testing.T) {
+	ctl, err := NewWithOptions(
+		WithGlusterfsCSIDriverName(conformanceGlusterfsDriverName),
+		WithFlexVolumeDrivers(map[string]string{conformanceFlexDriverName: conformanceFlexCSIDriverName},
+			func(options map[string]string) (string, map[string]string, error) {
+				return options["volumeID"], map[string]string{}, nil
+			},
+			func(volumeHandle string, attributes map[string]string) (map[string]string, error) {
+				return map[string]string{"volumeID": volumeHandle}, nil
+			}),
+	)
+	if err != nil {
+		t.Fatalf("Error when creating translator: %v", err)
+	}
+	fixtures := conformanceFixtures()
+
+	var driverNames []string
+	for driverName := range ctl.getInTreePlugins() {
+		driverNames = append(driverNames, driverName)
+	}
+	sort.Strings(driverNames)
+
+	var report []string
+	for _, driverName := range driverNames {
+		plugin := ctl.getInTreePlugins()[driverName]
+		fixture, ok := fixtures[driverName]
+		if !ok {
+			t.Errorf("No conformance fixture for plugin %s, add one to conformanceFixtures", plugin.GetInTreePluginName())
+			continue
+		}
+		if plugin.GetCSIPluginName() != driverName {
+			t.Errorf("Plugin %s is registered for CSI driver %s but reports %s", plugin.GetInTreePluginName(), driverName, plugin.GetCSIPluginName())
+		}
+
+		var capabilities []string
+		t.Run(driverName, func(t *testing.T) {
+			for _, p := range conformanceProbes {
+				p := p
+				t.Run(p.name, func(t *testing.T) {
+					err := p.probe(t, ctl, driverName, plugin, fixture)
+					switch {
+					case err == nil:
+						capabilities = append(capabilities, p.name+"=supported")
+					case err == errNotTranslated:
+						capabilities = append(capabilities, p.name+"="+err.Error())
+					case isUnsupportedError(err):
+						capabilities = append(capabilities, p.name+"=unsupported")
+						t.Logf("Unsupported: %v", err)
+					default:
+						t.Errorf("Expected a typed unsupported error, got: %v", err)
+					}
+				})
+			}
+		})
+		report = append(report, plugin.GetInTreePluginName()+": "+strings.Join(capabilities, ", "))
+	}
+	t.Logf("Capabilities:\n%s", strings.Join(report, "\n"))
+}
@@ -27,6 +27,7 @@ import (
 	storage "k8s.io/api/storage/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
 )
 
 const (
@@ -44,9 +45,21 @@ const (
 	// Per GB is too low for a given volume size. This preserves current
 	// in-tree volume plugin behavior.
 	allowIncreaseIOPSKey = "allowautoiopspergbincrease"
+	// encryptedKey is the StorageClass parameter name that specifies
+	// whether the volume is encrypted.
+	encryptedKey = "encrypted"
+	// kmsKeyIDKey is the StorageClass parameter name that specifies the ARN
+	// of the KMS key the volume is encrypted with.
+	kmsKeyIDKey = "kmsKeyId"
 )
 
 var _ InTreePlugin = &awsElasticBlockStoreCSITranslator{}
+var _ CSIStorageClassTranslator = &awsElasticBlockStoreCSITranslator{}
+
+// awsKMSKeyARNRegMatch represents Regex Match for the ARN of a KMS key
+// "arn:{partition}:kms:{region}:{account}:key/{keyId}" or of one of its
+// aliases "arn:{partition}:kms:{region}:{account}:alias/{aliasName}"
+var awsKMSKeyARNRegMatch = regexp.MustCompile("^arn:aws(-[a-z]+)*:kms:[a-z0-9-]+:[0-9]{12}:(key/[^/]+|alias/.+)$")
 
 // awsElasticBlockStoreTranslator handles translation of PV spec from In-tree EBS to CSI EBS and vice versa
 type awsElasticBlockStoreCSITranslator struct{}
@@ -76,11 +89,24 @@ func (t *awsElasticBlockStoreCSITranslator) TranslateInTreeStorageClassToCSI(sc
 			// Preserve current in-tree volume plugin behavior and allow the CSI
 			// driver to bump volume IOPS when volume size * iopsPerGB is too low.
 			params[allowIncreaseIOPSKey] = "true"
+		case encryptedKey, strings.ToLower(kmsKeyIDKey):
+			params[canonicalEBSParameterName(k)] = v
 		default:
 			params[k] = v
 		}
 	}
 
+	encrypted, err := validateEBSEncryptionParameters(params)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := params[kmsKeyIDKey]; ok && !encrypted {
+		// The in-tree volume plugin encrypts volumes whenever a KMS key is
+		// given, the CSI driver ignores the key of unencrypted volumes
+		klog.Warningf("StorageClass parameter %s is set, setting %s to true", kmsKeyIDKey, encryptedKey)
+		params[encryptedKey] = "true"
+	}
+
 	if len(generatedTopologies) > 0 && len(sc.AllowedTopologies) > 0 {
 		return nil, fmt.Errorf("cannot simultaneously set allowed topologies and zone/zones parameters")
 	} else if len(generatedTopologies) > 0 {
@@ -98,6 +124,77 @@ func (t *awsElasticBlockStoreCSITranslator) TranslateInTreeStorageClassToCSI(sc
 	return sc, nil
 }
 
+// TranslateCSIStorageClassToInTree translates CSI EBS storage class parameters
+// to InTree storage class
+func (t *awsElasticBlockStoreCSITranslator) TranslateCSIStorageClassToInTree(sc *storage.StorageClass) (*storage.StorageClass, error) {
+	params := map[string]string{}
+	for k, v := range sc.Parameters {
+		switch strings.ToLower(k) {
+		case csiFsTypeKey:
+			params[fsTypeKey] = v
+		case allowIncreaseIOPSKey:
+			// The in-tree volume plugin always increases IOPS
+		case encryptedKey, strings.ToLower(kmsKeyIDKey):
+			params[canonicalEBSParameterName(k)] = v
+		default:
+			params[k] = v
+		}
+	}
+
+	encrypted, err := validateEBSEncryptionParameters(params)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := params[kmsKeyIDKey]; ok && !encrypted {
+		// The CSI driver ignores the KMS key of unencrypted volumes, the
+		// in-tree volume plugin would encrypt them with it
+		klog.Warningf("StorageClass parameter %s is ignored as %s is not true", kmsKeyIDKey, encryptedKey)
+		delete(params, kmsKeyIDKey)
+	}
+
+	if len(sc.AllowedTopologies) > 0 {
+		newTopologies, err := translateAllowedTopologiesToInTree(sc.AllowedTopologies, AWSEBSTopologyKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed translating allowed topologies: %v", err)
+		}
+		sc.AllowedTopologies = newTopologies
+	}
+
+	sc.Parameters = params
+
+	return sc, nil
+}
+
+// canonicalEBSParameterName returns the name the EBS CSI driver documents for
+// the encryption parameter name, warning if name differs from it
+func canonicalEBSParameterName(name string) string {
+	canonicalName := encryptedKey
+	if strings.EqualFold(name, kmsKeyIDKey) {
+		canonicalName = kmsKeyIDKey
+	}
+	if name != canonicalName {
+		klog.Warningf("StorageClass parameter %q is translated to %q", name, canonicalName)
+	}
+	return canonicalName
+}
+
+// validateEBSEncryptionParameters validates the encryption parameters of an
+// EBS storage class and returns whether it encrypts volumes
+func validateEBSEncryptionParameters(params map[string]string) (bool, error) {
+	encrypted := false
+	if v, ok := params[encryptedKey]; ok {
+		var err error
+		encrypted, err = strconv.ParseBool(v)
+		if err != nil {
+			return false, fmt.Errorf("invalid %s %q: %v", encryptedKey, v, err)
+		}
+	}
+	if kmsKeyID, ok := params[kmsKeyIDKey]; ok && !awsKMSKeyARNRegMatch.MatchString(kmsKeyID) {
+		return false, fmt.Errorf("invalid %s %q, expected the ARN of a KMS key: arn:{partition}:kms:{region}:{account}:key/{keyId} or alias/{aliasName}", kmsKeyIDKey, kmsKeyID)
+	}
+	return encrypted, nil
+}
+
 // TranslateInTreeInlineVolumeToCSI takes a Volume with AWSElasticBlockStore set from in-tree
 // and converts the AWSElasticBlockStore source to a CSIPersistentVolumeSource
 func (t *awsElasticBlockStoreCSITranslator) TranslateInTreeInlineVolumeToCSI(volume *v1.Volume, podNamespace string) (*v1.PersistentVolume, error) {
@@ -141,6 +238,9 @@ func (t *awsElasticBlockStoreCSITranslator) TranslateInTreePVToCSI(pv *v1.Persis
 	}
 
 	ebsSource := pv.Spec.AWSElasticBlockStore
+	if err := validateWindowsPV(pv, ebsSource.FSType); err != nil {
+		return nil, err
+	}
 
 	volumeHandle, err := KubernetesVolumeIDToEBSVolumeID(ebsSource.VolumeID)
 	if err != nil {
@@ -30,6 +30,8 @@ const (
 	awsVolumeID     = "aws:///vol-02399794d890f9375"
 	awsZoneVolumeID = "aws://us-west-2a/vol-02399794d890f9375"
 	invalidVolumeID = "aws://us-west-2a/02399794d890f9375"
+	testKMSKeyARN   = "arn:aws:kms:us-west-2:111122223333:key/1234abcd-12ab-34cd-56ef-1234567890ab"
+	testKMSAliasARN = "arn:aws:kms:us-west-2:111122223333:alias/ebs"
 )
 
 func TestKubernetesVolumeIDToEBSVolumeID(t *testing.T) {
@@ -107,6 +109,41 @@ func TestTranslateEBSInTreeStorageClassToCSI(t *testing.T) {
 			sc:    NewStorageClass(map[string]string{"iopsPerGB": "100"}, nil),
 			expSc: NewStorageClass(map[string]string{"iopsPerGB": "100", "allowautoiopspergbincrease": "true"}, nil),
 		},
+		{
+			name:  "translate with encryption",
+			sc:    NewStorageClass(map[string]string{"encrypted": "true", "kmsKeyId": testKMSKeyARN}, nil),
+			expSc: NewStorageClass(map[string]string{"encrypted": "true", "kmsKeyId": testKMSKeyARN}, nil),
+		},
+		{
+			name:  "translate with differently cased encryption parameters",
+			sc:    NewStorageClass(map[string]string{"Encrypted": "true", "kmskeyid": testKMSKeyARN}, nil),
+			expSc: NewStorageClass(map[string]string{"encrypted": "true", "kmsKeyId": testKMSKeyARN}, nil),
+		},
+		{
+			name:  "translate kmsKeyId without encrypted",
+			sc:    NewStorageClass(map[string]string{"kmsKeyId": testKMSKeyARN}, nil),
+			expSc: NewStorageClass(map[string]string{"encrypted": "true", "kmsKeyId": testKMSKeyARN}, nil),
+		},
+		{
+			name:   "fails on invalid encrypted",
+			sc:     NewStorageClass(map[string]string{"encrypted": "yes"}, nil),
+			expErr: true,
+		},
+		{
+			name:   "fails on key id instead of ARN",
+			sc:     NewStorageClass(map[string]string{"encrypted": "true", "kmsKeyId": "1234abcd-12ab-34cd-56ef-1234567890ab"}, nil),
+			expErr: true,
+		},
+		{
+			name:  "translate with alias ARN",
+			sc:    NewStorageClass(map[string]string{"encrypted": "true", "kmsKeyId": testKMSAliasARN}, nil),
+			expSc: NewStorageClass(map[string]string{"encrypted": "true", "kmsKeyId": testKMSAliasARN}, nil),
+		},
+		{
+			name:   "fails on malformed ARN",
+			sc:     NewStorageClass(map[string]string{"encrypted": "true", "kmsKeyId": "arn:aws:kms:us-west-2:111122223333:alias"}, nil),
+			expErr: true,
+		},
 	}
 
 	for _, tc := range cases {
@@ -127,6 +164,84 @@ func TestTranslateEBSInTreeStorageClassToCSI(t *testing.T) {
 	}
 }
 
+func TestTranslateEBSCSIStorageClassToInTree(t *testing.T) {
+	translator := NewAWSElasticBlockStoreCSITranslator().(CSIStorageClassTranslator)
+
+	cases := []struct {
+		name   string
+		sc     *storage.StorageClass
+		expSc  *storage.StorageClass
+		expErr bool
+	}{
+		{
+			name:  "translate normal",
+			sc:    NewStorageClass(map[string]string{"foo": "bar"}, nil),
+			expSc: NewStorageClass(map[string]string{"foo": "bar"}, nil),
+		},
+		{
+			name:  "translate with fstype",
+			sc:    NewStorageClass(map[string]string{"csi.storage.k8s.io/fstype": "ext3"}, nil),
+			expSc: NewStorageClass(map[string]string{"fstype": "ext3"}, nil),
+		},
+		{
+			name:  "translate with iops",
+			sc:    NewStorageClass(map[string]string{"iopsPerGB": "100", "allowautoiopspergbincrease": "true"}, nil),
+			expSc: NewStorageClass(map[string]string{"iopsPerGB": "100"}, nil),
+		},
+		{
+			name:  "translate with encryption",
+			sc:    NewStorageClass(map[string]string{"encrypted": "true", "kmsKeyId": testKMSKeyARN}, nil),
+			expSc: NewStorageClass(map[string]string{"encrypted": "true", "kmsKeyId": testKMSKeyARN}, nil),
+		},
+		{
+			name:  "translate with differently cased encryption parameters",
+			sc:    NewStorageClass(map[string]string{"ENCRYPTED": "true", "kmsKeyID": testKMSKeyARN}, nil),
+			expSc: NewStorageClass(map[string]string{"encrypted": "true", "kmsKeyId": testKMSKeyARN}, nil),
+		},
+		{
+			name:  "drops kmsKeyId of unencrypted volumes",
+			sc:    NewStorageClass(map[string]string{"encrypted": "false", "kmsKeyId": testKMSKeyARN}, nil),
+			expSc: NewStorageClass(map[string]string{"encrypted": "false"}, nil),
+		},
+		{
+			name:  "translate topology",
+			sc:    NewStorageClass(map[string]string{}, generateToplogySelectors(AWSEBSTopologyKey, []string{"us-east-1a"})),
+			expSc: NewStorageClass(map[string]string{}, generateToplogySelectors(v1.LabelTopologyZone, []string{"us-east-1a"})),
+		},
+		{
+			name:  "translate with alias ARN",
+			sc:    NewStorageClass(map[string]string{"encrypted": "true", "kmsKeyId": testKMSAliasARN}, nil),
+			expSc: NewStorageClass(map[string]string{"encrypted": "true", "kmsKeyId": testKMSAliasARN}, nil),
+		},
+		{
+			name:   "fails on malformed ARN",
+			sc:     NewStorageClass(map[string]string{"encrypted": "true", "kmsKeyId": "arn:aws:kms:us-west-2:111122223333:keyring/ebs"}, nil),
+			expErr: true,
+		},
+		{
+			name:   "fails on invalid kmsKeyId",
+			sc:     NewStorageClass(map[string]string{"encrypted": "true", "kmsKeyId": "arn:aws:kms:us-west-2:1234:key/abcd"}, nil),
+			expErr: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Logf("Testing %v", tc.name)
+		got, err := translator.TranslateCSIStorageClassToInTree(tc.sc)
+		if err != nil && !tc.expErr {
+			t.Errorf("Did not expect error but got: %v", err)
+		}
+
+		if err == nil && tc.expErr {
+			t.Errorf("Expected error, but did not get one.")
+		}
+
+		if !reflect.DeepEqual(got, tc.expSc) {
+			t.Errorf("Got parameters: %v, expected :%v", got, tc.expSc)
+		}
+	}
+}
+
 func TestTranslateInTreeInlineVolumeToCSI(t *testing.T) {
 	translator := NewAWSElasticBlockStoreCSITranslator()
 
@@ -36,18 +36,34 @@ const (
 
 	// Parameter names defined in azure disk CSI driver, refer to
 	// https://github.com/kubernetes-sigs/azuredisk-csi-driver/blob/master/docs/driver-parameters.md
-	azureDiskKind        = "kind"
-	azureDiskCachingMode = "cachingMode"
-	azureDiskFSType      = "fsType"
+	azureDiskKind                = "kind"
+	azureDiskCachingMode         = "cachingMode"
+	azureDiskFSType              = "fsType"
+	azureDiskEncryptionSetID     = "diskEncryptionSetID"
+	azureDiskSkuName             = "skuName"
+	azureDiskStorageAccountType  = "storageAccountType"
+	azureDiskUltraSSDSkuName     = "UltraSSD_LRS"
+	azureDiskPremiumV2SSDSkuName = "PremiumV2_LRS"
+
+	// diskEncryptionSetIDFmt is the format of a disk encryption set ID. Like
+	// the CSI driver, only the case insensitive "/subscriptions/" prefix of
+	// the ID is checked.
+	diskEncryptionSetIDFmt = "/subscriptions/{subscription}/resourceGroups/{resourceGroup}/providers/Microsoft.Compute/diskEncryptionSets/{name}"
 )
 
 var (
-	managedDiskPathRE   = regexp.MustCompile(`.*/subscriptions/(?:.*)/resourceGroups/(?:.*)/providers/Microsoft.Compute/disks/(.+)`)
-	unmanagedDiskPathRE = regexp.MustCompile(`http(?:.*)://(?:.*)/vhds/(.+)`)
-	managed             = string(v1.AzureManagedDisk)
+	managedDiskPathRE     = regexp.MustCompile(`.*/subscriptions/(?:.*)/resourceGroups/(?:.*)/providers/Microsoft.Compute/disks/(.+)`)
+	unmanagedDiskPathRE   = regexp.MustCompile(`http(?:.*)://(?:.*)/vhds/(.+)`)
+	managed               = string(v1.AzureManagedDisk)
+	azureDiskCachingModes = []v1.AzureDataDiskCachingMode{
+		v1.AzureDataDiskCachingNone,
+		v1.AzureDataDiskCachingReadOnly,
+		v1.AzureDataDiskCachingReadWrite,
+	}
 )
 
 var _ InTreePlugin = &azureDiskCSITranslator{}
+var _ CSIStorageClassTranslator = &azureDiskCSITranslator{}
 
 // azureDiskCSITranslator handles translation of PV spec from In-tree
 // Azure Disk to CSI Azure Disk and vice versa
@@ -70,11 +86,19 @@ func (t *azureDiskCSITranslator) TranslateInTreeStorageClassToCSI(sc *storage.St
 			generatedTopologies = generateToplogySelectors(AzureDiskTopologyKey, []string{v})
 		case zonesKey:
 			generatedTopologies = generateToplogySelectors(AzureDiskTopologyKey, strings.Split(v, ","))
+		case strings.ToLower(azureDiskCachingMode):
+			params[azureDiskCachingMode] = canonicalAzureDiskCachingMode(v)
+		case azureDiskKind, strings.ToLower(azureDiskEncryptionSetID):
+			params[canonicalAzureDiskParameterName(k)] = v
 		default:
 			params[k] = v
 		}
 	}
 
+	if err := validateAzureDiskParameters(params); err != nil {
+		return nil, err
+	}
+
 	if len(generatedTopologies) > 0 && len(sc.AllowedTopologies) > 0 {
 		return nil, fmt.Errorf("cannot simultaneously set allowed topologies and zone/zones parameters")
 	} else if len(generatedTopologies) > 0 {
@@ -92,6 +116,40 @@ func (t *azureDiskCSITranslator) TranslateInTreeStorageClassToCSI(sc *storage.St
 	return sc, nil
 }
 
+// TranslateCSIStorageClassToInTree translates CSI Azure Disk storage class
+// parameters to InTree storage class
+func (t *azureDiskCSITranslator) TranslateCSIStorageClassToInTree(sc *storage.StorageClass) (*storage.StorageClass, error) {
+	params := map[string]string{}
+	for k, v := range sc.Parameters {
+		switch strings.ToLower(k) {
+		case csiFsTypeKey:
+			params[fsTypeKey] = v
+		case strings.ToLower(azureDiskCachingMode):
+			params[azureDiskCachingMode] = canonicalAzureDiskCachingMode(v)
+		case azureDiskKind, strings.ToLower(azureDiskEncryptionSetID):
+			params[canonicalAzureDiskParameterName(k)] = v
+		default:
+			params[k] = v
+		}
+	}
+
+	if err := validateAzureDiskParameters(params); err != nil {
+		return nil, err
+	}
+
+	if len(sc.AllowedTopologies) > 0 {
+		newTopologies, err := translateAllowedTopologiesToInTree(sc.AllowedTopologies, AzureDiskTopologyKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed translating allowed topologies: %v", err)
+		}
+		sc.AllowedTopologies = newTopologies
+	}
+
+	sc.Parameters = params
+
+	return sc, nil
+}
+
 // TranslateInTreeInlineVolumeToCSI takes a Volume with AzureDisk set from in-tree
 // and converts the AzureDisk source to a CSIPersistentVolumeSource
 func (t *azureDiskCSITranslator) TranslateInTreeInlineVolumeToCSI(volume *v1.Volume, podNamespace string) (*v1.PersistentVolume, error) {
@@ -100,8 +158,10 @@ func (t *azureDiskCSITranslator) TranslateInTreeInlineVolumeToCSI(volume *v1.Vol
 	}
 
 	azureSource := volume.AzureDisk
-	if azureSource.Kind != nil && !strings.EqualFold(string(*azureSource.Kind), managed) {
-		return nil, fmt.Errorf("kind(%v) is not supported in csi migration", *azureSource.Kind)
+	if azureSource.Kind != nil {
+		if err := validateAzureDiskKind(string(*azureSource.Kind)); err != nil {
+			return nil, err
+		}
 	}
 	pv := &v1.PersistentVolume{
 		ObjectMeta: metav1.ObjectMeta{
@@ -125,7 +185,11 @@ func (t *azureDiskCSITranslator) TranslateInTreeInlineVolumeToCSI(volume *v1.Vol
 	}
 
 	if azureSource.CachingMode != nil && *azureSource.CachingMode != "" {
-		pv.Spec.PersistentVolumeSource.CSI.VolumeAttributes[azureDiskCachingMode] = string(*azureSource.CachingMode)
+		cachingMode, err := normalizeAzureDiskCachingMode(string(*azureSource.CachingMode))
+		if err != nil {
+			return nil, err
+		}
+		pv.Spec.PersistentVolumeSource.CSI.VolumeAttributes[azureDiskCachingMode] = cachingMode
 	}
 	if azureSource.FSType != nil {
 		pv.Spec.PersistentVolumeSource.CSI.FSType = *azureSource.FSType
@@ -154,12 +218,26 @@ func (t *azureDiskCSITranslator) TranslateInTreePVToCSI(pv *v1.PersistentVolume)
 		}
 	)
 
-	if azureSource.Kind != nil && !strings.EqualFold(string(*azureSource.Kind), managed) {
-		return nil, fmt.Errorf("kind(%v) is not supported in csi migration", *azureSource.Kind)
+	if azureSource.Kind != nil {
+		if err := validateAzureDiskKind(string(*azureSource.Kind)); err != nil {
+			return nil, err
+		}
+	}
+
+	fsType := ""
+	if azureSource.FSType != nil {
+		fsType = *azureSource.FSType
+	}
+	if err := validateWindowsPV(pv, fsType); err != nil {
+		return nil, err
 	}
 
 	if azureSource.CachingMode != nil {
-		csiSource.VolumeAttributes[azureDiskCachingMode] = string(*azureSource.CachingMode)
+		cachingMode, err := normalizeAzureDiskCachingMode(string(*azureSource.CachingMode))
+		if err != nil {
+			return nil, err
+		}
+		csiSource.VolumeAttributes[azureDiskCachingMode] = cachingMode
 	}
 
 	if azureSource.FSType != nil {
@@ -203,7 +281,17 @@ func (t *azureDiskCSITranslator) TranslateCSIPVToInTree(pv *v1.PersistentVolume)
 	}
 
 	if csiSource.VolumeAttributes != nil {
+		if kind, ok := csiSource.VolumeAttributes[azureDiskKind]; ok && kind != "" {
+			if err := validateAzureDiskKind(kind); err != nil {
+				return nil, err
+			}
+		}
+
 		if cachingMode, ok := csiSource.VolumeAttributes[azureDiskCachingMode]; ok {
+			cachingMode, err := normalizeAzureDiskCachingMode(cachingMode)
+			if err != nil {
+				return nil, err
+			}
 			mode := v1.AzureDataDiskCachingMode(cachingMode)
 			azureSource.CachingMode = &mode
 		}
@@ -248,6 +336,107 @@ func (t *azureDiskCSITranslator) RepairVolumeHandle(volumeHandle, nodeID string)
 	return volumeHandle, nil
 }
 
+// canonicalAzureDiskParameterName returns the name the Azure Disk CSI driver
+// documents for the storage class parameter name
+func canonicalAzureDiskParameterName(name string) string {
+	for _, canonicalName := range []string{azureDiskKind, azureDiskCachingMode, azureDiskEncryptionSetID} {
+		if strings.EqualFold(name, canonicalName) {
+			return canonicalName
+		}
+	}
+	return name
+}
+
+// validateAzureDiskParameters validates the kind, cachingMode and
+// diskEncryptionSetID storage class parameters, which must be set under their
+// canonical names and, for cachingMode, values.
+func validateAzureDiskParameters(params map[string]string) error {
+	if kind, ok := params[azureDiskKind]; ok {
+		if err := validateAzureDiskKind(kind); err != nil {
+			return err
+		}
+	}
+
+	if desID, ok := params[azureDiskEncryptionSetID]; ok && !strings.HasPrefix(strings.ToLower(desID), "/subscriptions/") {
+		return fmt.Errorf("invalid %s %q, correct format: %s", azureDiskEncryptionSetID, desID, diskEncryptionSetIDFmt)
+	}
+
+	cachingMode := params[azureDiskCachingMode]
+	if err := validateAzureDiskCachingMode(cachingMode); err != nil {
+		return err
+	}
+	if cachingMode == "" {
+		// An empty cachingMode leaves the default of the driver like an unset one
+		return nil
+	}
+
+	// Ultra and Premium SSD v2 disks do not support host caching, the in-tree
+	// plugin ignores cachingMode for them while the CSI driver fails
+	for k, v := range params {
+		switch strings.ToLower(k) {
+		case strings.ToLower(azureDiskSkuName), strings.ToLower(azureDiskStorageAccountType):
+			if (strings.EqualFold(v, azureDiskUltraSSDSkuName) || strings.EqualFold(v, azureDiskPremiumV2SSDSkuName)) &&
+				cachingMode != string(v1.AzureDataDiskCachingNone) {
+				return &ErrUnsupportedParameters{
+					InTreePluginName: AzureDiskInTreePluginName,
+					Parameters:       map[string]string{k: v, azureDiskCachingMode: cachingMode},
+					Reason:           fmt.Sprintf("%s must be %s for %s disks", azureDiskCachingMode, v1.AzureDataDiskCachingNone, v),
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// validateAzureDiskKind returns an ErrUnsupportedParameters unless kind is
+// Managed, the CSI driver does not support unmanaged (Shared or Dedicated) disks
+func validateAzureDiskKind(kind string) error {
+	if !strings.EqualFold(kind, managed) {
+		return &ErrUnsupportedParameters{
+			InTreePluginName: AzureDiskInTreePluginName,
+			Parameters:       map[string]string{azureDiskKind: kind},
+			Reason:           "only managed disks are supported",
+		}
+	}
+	return nil
+}
+
+// validateAzureDiskCachingMode checks that cachingMode is one of the caching
+// modes of the API. Empty leaves the default of the driver.
+func validateAzureDiskCachingMode(cachingMode string) error {
+	if cachingMode == "" {
+		return nil
+	}
+	for _, mode := range azureDiskCachingModes {
+		if cachingMode == string(mode) {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid %s %q, supported values: %v", azureDiskCachingMode, cachingMode, azureDiskCachingModes)
+}
+
+// normalizeAzureDiskCachingMode returns the caching mode of the API equal to
+// cachingMode ignoring case, or an error if there is none
+func normalizeAzureDiskCachingMode(cachingMode string) (string, error) {
+	cachingMode = canonicalAzureDiskCachingMode(cachingMode)
+	if err := validateAzureDiskCachingMode(cachingMode); err != nil {
+		return "", err
+	}
+	return cachingMode, nil
+}
+
+// canonicalAzureDiskCachingMode returns the caching mode of the API equal to
+// cachingMode ignoring case. Unknown caching modes are returned unchanged and
+// rejected by validateAzureDiskCachingMode.
+func canonicalAzureDiskCachingMode(cachingMode string) string {
+	for _, mode := range azureDiskCachingModes {
+		if strings.EqualFold(cachingMode, string(mode)) {
+			return string(mode)
+		}
+	}
+	return cachingMode
+}
+
 func isManagedDisk(diskURI string) bool {
 	if len(diskURI) > 4 && strings.ToLower(diskURI[:4]) == "http" {
 		return false
@@ -17,6 +17,7 @@ limitations under the License.
 package plugins
 
 import (
+	"errors"
 	"fmt"
 	"reflect"
 	"testing"
@@ -99,6 +100,8 @@ func TestGetDiskName(t *testing.T) {
 
 func TestTranslateAzureDiskInTreeStorageClassToCSI(t *testing.T) {
 	sharedBlobDiskKind := v1.AzureDedicatedBlobDisk
+	lowerCachingMode := corev1.AzureDataDiskCachingMode("readonly")
+	invalidCachingMode := corev1.AzureDataDiskCachingMode("cachingmode")
 	translator := NewAzureDiskCSITranslator()
 
 	cases := []struct {
@@ -155,6 +158,46 @@ func TestTranslateAzureDiskInTreeStorageClassToCSI(t *testing.T) {
 			},
 			expErr: true,
 		},
+		{
+			name: "azure disk volume with lowercase caching mode",
+			volume: &corev1.Volume{
+				VolumeSource: corev1.VolumeSource{
+					AzureDisk: &corev1.AzureDiskVolumeSource{
+						DiskName:    "diskname",
+						DataDiskURI: "datadiskuri",
+						CachingMode: &lowerCachingMode,
+					},
+				},
+			},
+			expVol: &corev1.PersistentVolume{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "disk.csi.azure.com-diskname",
+				},
+				Spec: corev1.PersistentVolumeSpec{
+					PersistentVolumeSource: corev1.PersistentVolumeSource{
+						CSI: &corev1.CSIPersistentVolumeSource{
+							Driver:           "disk.csi.azure.com",
+							VolumeHandle:     "datadiskuri",
+							VolumeAttributes: map[string]string{azureDiskKind: "Managed", azureDiskCachingMode: "ReadOnly"},
+						},
+					},
+					AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+				},
+			},
+		},
+		{
+			name: "azure disk volume with invalid caching mode",
+			volume: &corev1.Volume{
+				VolumeSource: corev1.VolumeSource{
+					AzureDisk: &corev1.AzureDiskVolumeSource{
+						DiskName:    "diskname",
+						DataDiskURI: "datadiskuri",
+						CachingMode: &invalidCachingMode,
+					},
+				},
+			},
+			expErr: true,
+		},
 	}
 
 	for _, tc := range cases {
@@ -178,8 +221,10 @@ func TestTranslateAzureDiskInTreePVToCSI(t *testing.T) {
 	translator := NewAzureDiskCSITranslator()
 
 	sharedBlobDiskKind := v1.AzureDedicatedBlobDisk
-	cachingMode := corev1.AzureDataDiskCachingMode("cachingmode")
+	cachingMode := corev1.AzureDataDiskCachingMode("readonly")
+	invalidCachingMode := corev1.AzureDataDiskCachingMode("cachingmode")
 	fsType := "fstype"
+	ntfs := "ntfs"
 	readOnly := true
 	diskURI := "/subscriptions/12/resourceGroups/23/providers/Microsoft.Compute/disks/name"
 
@@ -220,7 +265,7 @@ func TestTranslateAzureDiskInTreePVToCSI(t *testing.T) {
 							FSType:   "fstype",
 							ReadOnly: true,
 							VolumeAttributes: map[string]string{
-								azureDiskCachingMode: "cachingmode",
+								azureDiskCachingMode: "ReadOnly",
 								azureDiskFSType:      fsType,
 								azureDiskKind:        "Managed",
 							},
@@ -247,6 +292,65 @@ func TestTranslateAzureDiskInTreePVToCSI(t *testing.T) {
 			},
 			expErr: true,
 		},
+		{
+			name: "azure disk volume with invalid caching mode",
+			volume: &corev1.PersistentVolume{
+				Spec: corev1.PersistentVolumeSpec{
+					PersistentVolumeSource: corev1.PersistentVolumeSource{
+						AzureDisk: &corev1.AzureDiskVolumeSource{
+							CachingMode: &invalidCachingMode,
+							DataDiskURI: diskURI,
+						},
+					},
+				},
+			},
+			expErr: true,
+		},
+		{
+			name: "azure disk volume with ntfs on windows",
+			volume: &corev1.PersistentVolume{
+				Spec: corev1.PersistentVolumeSpec{
+					PersistentVolumeSource: corev1.PersistentVolumeSource{
+						AzureDisk: &corev1.AzureDiskVolumeSource{
+							DataDiskURI: diskURI,
+							FSType:      &ntfs,
+						},
+					},
+					NodeAffinity: windowsNodeAffinity,
+				},
+			},
+			expVol: &corev1.PersistentVolume{
+				Spec: corev1.PersistentVolumeSpec{
+					PersistentVolumeSource: corev1.PersistentVolumeSource{
+						CSI: &corev1.CSIPersistentVolumeSource{
+							Driver: "disk.csi.azure.com",
+							FSType: "ntfs",
+							VolumeAttributes: map[string]string{
+								azureDiskFSType: "ntfs",
+								azureDiskKind:   "Managed",
+							},
+							VolumeHandle: diskURI,
+						},
+					},
+					NodeAffinity: windowsNodeAffinity,
+				},
+			},
+		},
+		{
+			name: "azure disk volume with ntfs on linux",
+			volume: &corev1.PersistentVolume{
+				Spec: corev1.PersistentVolumeSpec{
+					PersistentVolumeSource: corev1.PersistentVolumeSource{
+						AzureDisk: &corev1.AzureDiskVolumeSource{
+							DataDiskURI: diskURI,
+							FSType:      &ntfs,
+						},
+					},
+					NodeAffinity: linuxNodeAffinity,
+				},
+			},
+			expErr: true,
+		},
 	}
 
 	for _, tc := range cases {
@@ -267,7 +371,7 @@ func TestTranslateAzureDiskInTreePVToCSI(t *testing.T) {
 }
 
 func TestTranslateTranslateCSIPVToInTree(t *testing.T) {
-	cachingMode := corev1.AzureDataDiskCachingMode("cachingmode")
+	cachingMode := corev1.AzureDataDiskCachingReadOnly
 	fsType := "fstype"
 	readOnly := true
 	diskURI := "/subscriptions/12/resourceGroups/23/providers/Microsoft.Compute/disks/name"
@@ -290,7 +394,7 @@ func TestTranslateTranslateCSIPVToInTree(t *testing.T) {
 							FSType:   "fstype",
 							ReadOnly: true,
 							VolumeAttributes: map[string]string{
-								azureDiskCachingMode: "cachingmode",
+								azureDiskCachingMode: "readonly",
 								azureDiskFSType:      fsType,
 								azureDiskKind:        "managed",
 							},
@@ -315,6 +419,23 @@ func TestTranslateTranslateCSIPVToInTree(t *testing.T) {
 			},
 			expErr: false,
 		},
+		{
+			name: "azure disk volume with invalid caching mode",
+			volume: &corev1.PersistentVolume{
+				Spec: corev1.PersistentVolumeSpec{
+					PersistentVolumeSource: corev1.PersistentVolumeSource{
+						CSI: &corev1.CSIPersistentVolumeSource{
+							Driver: "disk.csi.azure.com",
+							VolumeAttributes: map[string]string{
+								azureDiskCachingMode: "cachingmode",
+							},
+							VolumeHandle: diskURI,
+						},
+					},
+				},
+			},
+			expErr: true,
+		},
 	}
 
 	for _, tc := range cases {
@@ -334,6 +455,8 @@ func TestTranslateTranslateCSIPVToInTree(t *testing.T) {
 	}
 }
 
+const testDiskEncryptionSetID = "/subscriptions/12/resourceGroups/23/providers/Microsoft.Compute/diskEncryptionSets/des"
+
 func TestTranslateInTreeStorageClassToCSI(t *testing.T) {
 	translator := NewAzureDiskCSITranslator()
 
@@ -383,6 +506,41 @@ func TestTranslateInTreeStorageClassToCSI(t *testing.T) {
 			options: NewStorageClass(map[string]string{"zone": "foo"}, generateToplogySelectors(AzureDiskTopologyKey, []string{"foo"})),
 			expErr:  true,
 		},
+		{
+			name:       "caching mode, kind and disk encryption set",
+			options:    NewStorageClass(map[string]string{"cachingmode": "readonly", "kind": "managed", "DiskEncryptionSetID": testDiskEncryptionSetID}, nil),
+			expOptions: NewStorageClass(map[string]string{"cachingMode": "ReadOnly", "kind": "managed", "diskEncryptionSetID": testDiskEncryptionSetID}, nil),
+		},
+		{
+			name:       "ultra disk without caching",
+			options:    NewStorageClass(map[string]string{"skuName": "UltraSSD_LRS", "cachingMode": "None"}, nil),
+			expOptions: NewStorageClass(map[string]string{"skuName": "UltraSSD_LRS", "cachingMode": "None"}, nil),
+		},
+		{
+			name:    "ultra disk with caching",
+			options: NewStorageClass(map[string]string{"storageaccounttype": "UltraSSD_LRS", "cachingMode": "ReadOnly"}, nil),
+			expErr:  true,
+		},
+		{
+			name:    "shared kind",
+			options: NewStorageClass(map[string]string{"kind": "shared"}, nil),
+			expErr:  true,
+		},
+		{
+			name:       "lowercase disk encryption set",
+			options:    NewStorageClass(map[string]string{"diskEncryptionSetID": "/subscriptions/12/resourcegroups/23/providers/microsoft.compute/diskencryptionsets/des"}, nil),
+			expOptions: NewStorageClass(map[string]string{"diskEncryptionSetID": "/subscriptions/12/resourcegroups/23/providers/microsoft.compute/diskencryptionsets/des"}, nil),
+		},
+		{
+			name:    "invalid disk encryption set",
+			options: NewStorageClass(map[string]string{"diskEncryptionSetID": "des"}, nil),
+			expErr:  true,
+		},
+		{
+			name:    "invalid caching mode",
+			options: NewStorageClass(map[string]string{"cachingMode": "WriteOnly"}, nil),
+			expErr:  true,
+		},
 	}
 
 	for _, tc := range tcs {
@@ -399,3 +557,179 @@ func TestTranslateInTreeStorageClassToCSI(t *testing.T) {
 		}
 	}
 }
+
+func TestTranslateAzureDiskCSIStorageClassToInTree(t *testing.T) {
+	translator := NewAzureDiskCSITranslator().(CSIStorageClassTranslator)
+
+	tcs := []struct {
+		name       string
+		options    *storage.StorageClass
+		expOptions *storage.StorageClass
+		expErr     bool
+	}{
+		{
+			name:       "nothing special",
+			options:    NewStorageClass(map[string]string{"foo": "bar"}, nil),
+			expOptions: NewStorageClass(map[string]string{"foo": "bar"}, nil),
+		},
+		{
+			name:       "fstype",
+			options:    NewStorageClass(map[string]string{"csi.storage.k8s.io/fstype": "ext4"}, nil),
+			expOptions: NewStorageClass(map[string]string{"fstype": "ext4"}, nil),
+		},
+		{
+			name:       "topology",
+			options:    NewStorageClass(map[string]string{}, generateToplogySelectors(AzureDiskTopologyKey, []string{"foo"})),
+			expOptions: NewStorageClass(map[string]string{}, generateToplogySelectors(v1.LabelTopologyZone, []string{"foo"})),
+		},
+		{
+			name:       "caching mode, kind and disk encryption set",
+			options:    NewStorageClass(map[string]string{"cachingMode": "ReadWrite", "kind": "Managed", "diskEncryptionSetID": testDiskEncryptionSetID}, nil),
+			expOptions: NewStorageClass(map[string]string{"cachingMode": "ReadWrite", "kind": "Managed", "diskEncryptionSetID": testDiskEncryptionSetID}, nil),
+		},
+		{
+			name:       "lowercase caching mode",
+			options:    NewStorageClass(map[string]string{"cachingmode": "none"}, nil),
+			expOptions: NewStorageClass(map[string]string{"cachingMode": "None"}, nil),
+		},
+		{
+			name:    "premium v2 disk with caching",
+			options: NewStorageClass(map[string]string{"skuName": "PremiumV2_LRS", "cachingMode": "ReadWrite"}, nil),
+			expErr:  true,
+		},
+		{
+			name:    "invalid caching mode",
+			options: NewStorageClass(map[string]string{"cachingMode": "WriteOnly"}, nil),
+			expErr:  true,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Logf("Testing %v", tc.name)
+		gotOptions, err := translator.TranslateCSIStorageClassToInTree(tc.options)
+		if err != nil && !tc.expErr {
+			t.Errorf("Did not expect error but got: %v", err)
+		}
+		if err == nil && tc.expErr {
+			t.Errorf("Expected error, but did not get one.")
+		}
+		if !reflect.DeepEqual(gotOptions, tc.expOptions) {
+			t.Errorf("Got parameters: %v, expected :%v", gotOptions, tc.expOptions)
+		}
+	}
+}
+
+func TestAzureDiskUnsupportedParameters(t *testing.T) {
+	sharedBlobDiskKind := v1.AzureSharedBlobDisk
+	diskURI := "/subscriptions/12/resourceGroups/23/providers/Microsoft.Compute/disks/name"
+	translator := NewAzureDiskCSITranslator()
+
+	tcs := []struct {
+		name      string
+		translate func() error
+	}{
+		{
+			name: "in-tree PV with shared kind",
+			translate: func() error {
+				_, err := translator.TranslateInTreePVToCSI(&corev1.PersistentVolume{
+					Spec: corev1.PersistentVolumeSpec{
+						PersistentVolumeSource: corev1.PersistentVolumeSource{
+							AzureDisk: &corev1.AzureDiskVolumeSource{
+								DiskName:    "name",
+								DataDiskURI: diskURI,
+								Kind:        &sharedBlobDiskKind,
+							},
+						},
+					},
+				})
+				return err
+			},
+		},
+		{
+			name: "CSI PV with shared kind",
+			translate: func() error {
+				_, err := translator.TranslateCSIPVToInTree(&corev1.PersistentVolume{
+					Spec: corev1.PersistentVolumeSpec{
+						PersistentVolumeSource: corev1.PersistentVolumeSource{
+							CSI: &corev1.CSIPersistentVolumeSource{
+								Driver:           AzureDiskDriverName,
+								VolumeHandle:     diskURI,
+								VolumeAttributes: map[string]string{azureDiskKind: "Shared"},
+							},
+						},
+					},
+				})
+				return err
+			},
+		},
+		{
+			name: "storage class of ultra disk with caching",
+			translate: func() error {
+				_, err := translator.TranslateInTreeStorageClassToCSI(NewStorageClass(map[string]string{"skuname": "ultrassd_lrs", "cachingMode": "ReadOnly"}, nil))
+				return err
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Logf("Testing %v", tc.name)
+		err := tc.translate()
+		var unsupportedErr *ErrUnsupportedParameters
+		if !errors.As(err, &unsupportedErr) {
+			t.Errorf("Expected ErrUnsupportedParameters, got: %v", err)
+		}
+	}
+}
+
+func TestValidateAzureDiskParameters(t *testing.T) {
+	tcs := []struct {
+		name   string
+		params map[string]string
+		expErr bool
+	}{
+		{
+			name:   "valid parameters",
+			params: map[string]string{azureDiskKind: "Managed", azureDiskCachingMode: "ReadOnly", azureDiskEncryptionSetID: testDiskEncryptionSetID},
+		},
+		{
+			name:   "empty caching mode",
+			params: map[string]string{azureDiskCachingMode: ""},
+		},
+		{
+			name:   "non-canonical caching mode",
+			params: map[string]string{azureDiskCachingMode: "readonly"},
+			expErr: true,
+		},
+		{
+			name:   "ultra disk with caching",
+			params: map[string]string{azureDiskSkuName: azureDiskUltraSSDSkuName, azureDiskCachingMode: "ReadOnly"},
+			expErr: true,
+		},
+		{
+			name:   "ultra disk with empty caching mode",
+			params: map[string]string{azureDiskSkuName: azureDiskUltraSSDSkuName, azureDiskCachingMode: ""},
+		},
+		{
+			name:   "premium v2 disk without caching mode",
+			params: map[string]string{azureDiskSkuName: azureDiskPremiumV2SSDSkuName},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Logf("Testing %v", tc.name)
+		params := make(map[string]string, len(tc.params))
+		for k, v := range tc.params {
+			params[k] = v
+		}
+		err := validateAzureDiskParameters(params)
+		if err != nil && !tc.expErr {
+			t.Errorf("Did not expect error but got: %v", err)
+		}
+		if err == nil && tc.expErr {
+			t.Errorf("Expected error, but did not get one.")
+		}
+		if !reflect.DeepEqual(params, tc.params) {
+			t.Errorf("Parameters were modified to %v, expected: %v", params, tc.params)
+		}
+	}
+}
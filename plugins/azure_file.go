@@ -40,6 +40,8 @@ const (
 	shareNameField          = "sharename"
 	secretNameField         = "secretname"
 	secretNamespaceField    = "secretnamespace"
+	protocolField           = "protocol"
+	smbProtocol             = "smb"
 	secretNameTemplate      = "azure-storage-account-%s-secret"
 	defaultSecretNamespace  = "default"
 	resourceGroupAnnotation = "kubernetes.io/azure-file-resource-group"
@@ -116,6 +118,15 @@ func (t *azureFileCSITranslator) TranslateInTreePVToCSI(pv *v1.PersistentVolume)
 	if pv == nil || pv.Spec.AzureFile == nil {
 		return nil, fmt.Errorf("pv is nil or Azure File source not defined on pv")
 	}
+	if isBlockVolume(pv) {
+		return nil, &ErrBlockVolumeNotSupported{InTreePluginName: AzureFileInTreePluginName, Reason: "file shares can only be mounted as filesystem"}
+	}
+
+	// Azure File volumes have no fsType, only their mount options need to
+	// be checked
+	if err := validateWindowsPV(pv, ""); err != nil {
+		return nil, err
+	}
 
 	azureSource := pv.Spec.PersistentVolumeSource.AzureFile
 	accountName, err := getStorageAccountName(azureSource.SecretName)
@@ -149,6 +160,12 @@ func (t *azureFileCSITranslator) TranslateInTreePVToCSI(pv *v1.PersistentVolume)
 		csiSource.NodeStageSecretRef.Namespace = *azureSource.SecretNamespace
 	}
 
+	// csi-proxy can only mount SMB shares on Windows nodes, make the protocol
+	// explicit so the driver does not pick another one
+	if isWindowsPV(pv) {
+		csiSource.VolumeAttributes[protocolField] = smbProtocol
+	}
+
 	pv.Spec.PersistentVolumeSource.AzureFile = nil
 	pv.Spec.PersistentVolumeSource.CSI = csiSource
 
@@ -161,6 +178,9 @@ func (t *azureFileCSITranslator) TranslateCSIPVToInTree(pv *v1.PersistentVolume)
 	if pv == nil || pv.Spec.CSI == nil {
 		return nil, fmt.Errorf("pv is nil or CSI source not defined on pv")
 	}
+	if isBlockVolume(pv) {
+		return nil, &ErrBlockVolumeNotSupported{InTreePluginName: AzureFileInTreePluginName, Reason: "file shares can only be mounted as filesystem"}
+	}
 	csiSource := pv.Spec.CSI
 
 	// refer to https://github.com/kubernetes-sigs/azurefile-csi-driver/blob/master/docs/driver-parameters.md
@@ -177,6 +197,10 @@ func (t *azureFileCSITranslator) TranslateCSIPVToInTree(pv *v1.PersistentVolume)
 		case secretNamespaceField:
 			ns := v
 			azureSource.SecretNamespace = &ns
+		case protocolField:
+			if !strings.EqualFold(v, smbProtocol) {
+				return nil, fmt.Errorf("protocol %s is not supported by the in-tree Azure File plugin", v)
+			}
 		}
 	}
 
@@ -297,6 +297,62 @@ func TestTranslateAzureFileInTreePVToCSI(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "azure file volume on windows",
+			volume: &corev1.PersistentVolume{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "file.csi.azure.com-sharename",
+				},
+				Spec: corev1.PersistentVolumeSpec{
+					PersistentVolumeSource: corev1.PersistentVolumeSource{
+						AzureFile: &corev1.AzureFilePersistentVolumeSource{
+							ShareName:       "sharename",
+							SecretName:      "secretname",
+							SecretNamespace: &secretNamespace,
+						},
+					},
+					NodeAffinity: windowsNodeAffinity,
+				},
+			},
+			expVol: &corev1.PersistentVolume{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "file.csi.azure.com-sharename",
+				},
+				Spec: corev1.PersistentVolumeSpec{
+					PersistentVolumeSource: corev1.PersistentVolumeSource{
+						CSI: &corev1.CSIPersistentVolumeSource{
+							Driver: "file.csi.azure.com",
+							NodeStageSecretRef: &corev1.SecretReference{
+								Name:      "secretname",
+								Namespace: secretNamespace,
+							},
+							VolumeAttributes: map[string]string{
+								shareNameField: "sharename",
+								protocolField:  smbProtocol,
+							},
+							VolumeHandle: "#secretname#sharename#",
+						},
+					},
+					NodeAffinity: windowsNodeAffinity,
+				},
+			},
+		},
+		{
+			name: "azure file volume on windows with linux mount options",
+			volume: &corev1.PersistentVolume{
+				Spec: corev1.PersistentVolumeSpec{
+					PersistentVolumeSource: corev1.PersistentVolumeSource{
+						AzureFile: &corev1.AzureFilePersistentVolumeSource{
+							ShareName:  "sharename",
+							SecretName: "secretname",
+						},
+					},
+					MountOptions: []string{"dir_mode=0777", "file_mode=0777"},
+					NodeAffinity: windowsNodeAffinity,
+				},
+			},
+			expErr: true,
+		},
 	}
 
 	for _, tc := range cases {
@@ -549,6 +605,31 @@ func TestTranslateCSIPVToInTree(t *testing.T) {
 
 }
 
+func TestTranslateAzureFileCSIPVToInTreeProtocol(t *testing.T) {
+	translator := NewAzureFileCSITranslator()
+
+	for _, protocol := range []string{"smb", "SMB", "nfs"} {
+		t.Logf("Testing protocol %v", protocol)
+		pv := &corev1.PersistentVolume{
+			Spec: corev1.PersistentVolumeSpec{
+				PersistentVolumeSource: corev1.PersistentVolumeSource{
+					CSI: &corev1.CSIPersistentVolumeSource{
+						Driver:       AzureFileDriverName,
+						VolumeHandle: "rg#st#pvc-file-dynamic#diskname.vhd",
+						VolumeAttributes: map[string]string{
+							protocolField: protocol,
+						},
+					},
+				},
+			},
+		}
+		_, err := translator.TranslateCSIPVToInTree(pv)
+		if expErr := protocol == "nfs"; (err != nil) != expErr {
+			t.Errorf("Got error %v, expected error: %v", err, expErr)
+		}
+	}
+}
+
 func TestGetStorageAccount(t *testing.T) {
 	tests := []struct {
 		secretName     string
@@ -0,0 +1,227 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugins
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	storage "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// FlexVolumePluginNamePrefix is prepended to a FlexVolume driver name to
+	// get the name of the in-tree plugin serving it, e.g. "flexvolume-vendor/driver"
+	FlexVolumePluginNamePrefix = "flexvolume-"
+)
+
+// FlexVolumeOptionsTransformFn converts the options of a FlexVolume to the
+// volume handle and volume attributes understood by the CSI driver
+// superseding it.
+type FlexVolumeOptionsTransformFn func(options map[string]string) (volumeHandle string, attributes map[string]string, err error)
+
+// FlexVolumeOptionsInverseTransformFn converts the volume handle and volume
+// attributes of a CSI volume back to the options of the FlexVolume it was
+// translated from. It must be the inverse of the FlexVolumeOptionsTransformFn
+// of the driver for a rolled back PV to refer to the same volume.
+type FlexVolumeOptionsInverseTransformFn func(volumeHandle string, attributes map[string]string) (options map[string]string, err error)
+
+var _ InTreePlugin = &flexVolumeCSITranslator{}
+
+// flexVolumeCSITranslator handles translation of PV spec from a single
+// FlexVolume driver to the CSI driver superseding it and vice versa
+type flexVolumeCSITranslator struct {
+	flexDriverName   string
+	csiDriverName    string
+	transform        FlexVolumeOptionsTransformFn
+	inverseTransform FlexVolumeOptionsInverseTransformFn
+}
+
+// NewFlexVolumeCSITranslator returns a new instance of flexVolumeCSITranslator
+// migrating volumes of the FlexVolume driver flexDriverName to the CSI driver
+// csiDriverName. transform is used to compute the CSI volume handle and
+// attributes from the FlexVolume options, inverseTransform to compute the
+// options back from them. Without inverseTransform translating back to
+// FlexVolume fails.
+func NewFlexVolumeCSITranslator(flexDriverName, csiDriverName string, transform FlexVolumeOptionsTransformFn, inverseTransform FlexVolumeOptionsInverseTransformFn) InTreePlugin {
+	return &flexVolumeCSITranslator{
+		flexDriverName:   flexDriverName,
+		csiDriverName:    csiDriverName,
+		transform:        transform,
+		inverseTransform: inverseTransform,
+	}
+}
+
+// TranslateInTreeStorageClassToCSI always fails as FlexVolume drivers
+// cannot be dynamically provisioned by an in-tree provisioner
+func (f *flexVolumeCSITranslator) TranslateInTreeStorageClassToCSI(sc *storage.StorageClass) (*storage.StorageClass, error) {
+	return nil, &ErrStorageClassNotSupported{InTreePluginName: f.GetInTreePluginName()}
+}
+
+// TranslateInTreeInlineVolumeToCSI takes a Volume with FlexVolume set from in-tree
+// and converts the FlexVolume source to a CSIPersistentVolumeSource
+func (f *flexVolumeCSITranslator) TranslateInTreeInlineVolumeToCSI(volume *v1.Volume, podNamespace string) (*v1.PersistentVolume, error) {
+	if volume == nil || volume.FlexVolume == nil {
+		return nil, fmt.Errorf("volume is nil or FlexVolume not defined on volume")
+	}
+	flexSource := volume.FlexVolume
+
+	volumeHandle, attributes, err := f.transformOptions(flexSource.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	var am v1.PersistentVolumeAccessMode
+	if flexSource.ReadOnly {
+		am = v1.ReadOnlyMany
+	} else {
+		am = v1.ReadWriteOnce
+	}
+
+	pv := &v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{
+			// Must be unique per volume as it is used as the unique part of the
+			// staging path
+			Name: hashedInlinePVName(f.csiDriverName, volumeHandle),
+		},
+		Spec: v1.PersistentVolumeSpec{
+			PersistentVolumeSource: v1.PersistentVolumeSource{
+				CSI: &v1.CSIPersistentVolumeSource{
+					Driver:           f.csiDriverName,
+					VolumeHandle:     volumeHandle,
+					ReadOnly:         flexSource.ReadOnly,
+					FSType:           flexSource.FSType,
+					VolumeAttributes: attributes,
+				},
+			},
+			AccessModes: []v1.PersistentVolumeAccessMode{am},
+		},
+	}
+	if flexSource.SecretRef != nil {
+		pv.Spec.CSI.NodePublishSecretRef = &v1.SecretReference{
+			Name:      flexSource.SecretRef.Name,
+			Namespace: podNamespace,
+		}
+	}
+	return pv, nil
+}
+
+// TranslateInTreePVToCSI takes a PV with FlexVolume set from in-tree
+// and converts the FlexVolume source to a CSIPersistentVolumeSource
+func (f *flexVolumeCSITranslator) TranslateInTreePVToCSI(pv *v1.PersistentVolume) (*v1.PersistentVolume, error) {
+	if pv == nil || pv.Spec.FlexVolume == nil {
+		return nil, fmt.Errorf("pv is nil or FlexVolume not defined on pv")
+	}
+	if isBlockVolume(pv) {
+		return nil, &ErrBlockVolumeNotSupported{InTreePluginName: f.GetInTreePluginName(), Reason: "FlexVolume drivers only support filesystem volumes"}
+	}
+	flexSource := pv.Spec.FlexVolume
+
+	volumeHandle, attributes, err := f.transformOptions(flexSource.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	csiSource := &v1.CSIPersistentVolumeSource{
+		Driver:               f.csiDriverName,
+		VolumeHandle:         volumeHandle,
+		ReadOnly:             flexSource.ReadOnly,
+		FSType:               flexSource.FSType,
+		VolumeAttributes:     attributes,
+		NodePublishSecretRef: flexSource.SecretRef,
+	}
+
+	pv.Spec.FlexVolume = nil
+	pv.Spec.CSI = csiSource
+	return pv, nil
+}
+
+// TranslateCSIPVToInTree takes a PV with CSIPersistentVolumeSource set and
+// translates the CSI source to a FlexVolume source.
+func (f *flexVolumeCSITranslator) TranslateCSIPVToInTree(pv *v1.PersistentVolume) (*v1.PersistentVolume, error) {
+	if pv == nil || pv.Spec.CSI == nil {
+		return nil, fmt.Errorf("pv is nil or CSI source not defined on pv")
+	}
+	if isBlockVolume(pv) {
+		return nil, &ErrBlockVolumeNotSupported{InTreePluginName: f.GetInTreePluginName(), Reason: "FlexVolume drivers only support filesystem volumes"}
+	}
+	csiSource := pv.Spec.CSI
+
+	if f.inverseTransform == nil {
+		return nil, fmt.Errorf("no inverse options transform configured for FlexVolume driver %s", f.flexDriverName)
+	}
+	options, err := f.inverseTransform(csiSource.VolumeHandle, csiSource.VolumeAttributes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute options of FlexVolume driver %s: %v", f.flexDriverName, err)
+	}
+
+	flexSource := &v1.FlexPersistentVolumeSource{
+		Driver:    f.flexDriverName,
+		FSType:    csiSource.FSType,
+		SecretRef: csiSource.NodePublishSecretRef,
+		ReadOnly:  csiSource.ReadOnly,
+		Options:   options,
+	}
+
+	pv.Spec.CSI = nil
+	pv.Spec.FlexVolume = flexSource
+	return pv, nil
+}
+
+// CanSupport tests whether the plugin supports a given persistent volume
+// specification from the API.
+func (f *flexVolumeCSITranslator) CanSupport(pv *v1.PersistentVolume) bool {
+	return pv != nil && pv.Spec.FlexVolume != nil && pv.Spec.FlexVolume.Driver == f.flexDriverName
+}
+
+// CanSupportInline tests whether the plugin supports a given inline volume
+// specification from the API.
+func (f *flexVolumeCSITranslator) CanSupportInline(volume *v1.Volume) bool {
+	return volume != nil && volume.FlexVolume != nil && volume.FlexVolume.Driver == f.flexDriverName
+}
+
+// GetInTreePluginName returns the name of the in-tree plugin serving the FlexVolume driver
+func (f *flexVolumeCSITranslator) GetInTreePluginName() string {
+	return FlexVolumePluginNamePrefix + f.flexDriverName
+}
+
+// GetCSIPluginName returns the name of the CSI plugin
+func (f *flexVolumeCSITranslator) GetCSIPluginName() string {
+	return f.csiDriverName
+}
+
+// RepairVolumeHandle generates a correct volume handle based on node ID information.
+func (f *flexVolumeCSITranslator) RepairVolumeHandle(volumeHandle, nodeID string) (string, error) {
+	return volumeHandle, nil
+}
+
+// transformOptions runs the configured transform on the FlexVolume options
+// and validates its result
+func (f *flexVolumeCSITranslator) transformOptions(options map[string]string) (string, map[string]string, error) {
+	if f.transform == nil {
+		return "", nil, fmt.Errorf("no options transform configured for FlexVolume driver %s", f.flexDriverName)
+	}
+	volumeHandle, attributes, err := f.transform(options)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to transform options of FlexVolume driver %s: %v", f.flexDriverName, err)
+	}
+	if volumeHandle == "" {
+		return "", nil, fmt.Errorf("options transform of FlexVolume driver %s returned an empty volume handle", f.flexDriverName)
+	}
+	return volumeHandle, attributes, nil
+}
@@ -0,0 +1,375 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugins
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	testFlexDriverName = "example/lvm"
+	testFlexCSIDriver  = "lvm.csi.example.com"
+)
+
+// testFlexTransform uses the "volumeID" option as volume handle and passes
+// all other options through as volume attributes
+func testFlexTransform(options map[string]string) (string, map[string]string, error) {
+	volumeID, ok := options["volumeID"]
+	if !ok {
+		return "", nil, fmt.Errorf("missing volumeID option")
+	}
+	attributes := map[string]string{}
+	for k, v := range options {
+		if k != "volumeID" {
+			attributes[k] = v
+		}
+	}
+	return volumeID, attributes, nil
+}
+
+// testFlexInverseTransform is the inverse of testFlexTransform
+func testFlexInverseTransform(volumeHandle string, attributes map[string]string) (map[string]string, error) {
+	options := map[string]string{"volumeID": volumeHandle}
+	for k, v := range attributes {
+		options[k] = v
+	}
+	return options, nil
+}
+
+func TestTranslateFlexVolumeInTreeInlineVolumeToCSI(t *testing.T) {
+	translator := NewFlexVolumeCSITranslator(testFlexDriverName, testFlexCSIDriver, testFlexTransform, testFlexInverseTransform)
+
+	testCases := []struct {
+		name        string
+		inLine      *v1.Volume
+		csiVol      *v1.PersistentVolume
+		errExpected bool
+	}{
+		{
+			name: "normal",
+			inLine: &v1.Volume{
+				Name: "flexvol",
+				VolumeSource: v1.VolumeSource{
+					FlexVolume: &v1.FlexVolumeSource{
+						Driver:    testFlexDriverName,
+						FSType:    "ext4",
+						SecretRef: &v1.LocalObjectReference{Name: "lvm-secret"},
+						Options: map[string]string{
+							"volumeID": "vg0/lv0",
+							"size":     "1G",
+						},
+					},
+				},
+			},
+			csiVol: &v1.PersistentVolume{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: hashedInlinePVName(testFlexCSIDriver, "vg0/lv0"),
+				},
+				Spec: v1.PersistentVolumeSpec{
+					PersistentVolumeSource: v1.PersistentVolumeSource{
+						CSI: &v1.CSIPersistentVolumeSource{
+							Driver:           testFlexCSIDriver,
+							VolumeHandle:     "vg0/lv0",
+							FSType:           "ext4",
+							VolumeAttributes: map[string]string{"size": "1G"},
+							NodePublishSecretRef: &v1.SecretReference{
+								Name:      "lvm-secret",
+								Namespace: "ns",
+							},
+						},
+					},
+					AccessModes: []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce},
+				},
+			},
+		},
+		{
+			name: "transform error",
+			inLine: &v1.Volume{
+				Name: "flexvol",
+				VolumeSource: v1.VolumeSource{
+					FlexVolume: &v1.FlexVolumeSource{
+						Driver: testFlexDriverName,
+					},
+				},
+			},
+			errExpected: true,
+		},
+		{
+			name:        "nil",
+			errExpected: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Logf("Testing %v", tc.name)
+		result, err := translator.TranslateInTreeInlineVolumeToCSI(tc.inLine, "ns")
+		if err != nil && !tc.errExpected {
+			t.Errorf("Did not expect error but got: %v", err)
+		}
+		if err == nil && tc.errExpected {
+			t.Errorf("Expected error, but did not get one.")
+		}
+		if !reflect.DeepEqual(result, tc.csiVol) {
+			t.Errorf("Got parameters: %v\n, expected :%v", result, tc.csiVol)
+		}
+	}
+}
+
+func TestTranslateFlexVolumeInTreePVToCSI(t *testing.T) {
+	secretRef := &v1.SecretReference{Name: "lvm-secret", Namespace: "kube-system"}
+
+	testCases := []struct {
+		name        string
+		transform   FlexVolumeOptionsTransformFn
+		inTree      *v1.PersistentVolume
+		csi         *v1.PersistentVolume
+		errExpected bool
+	}{
+		{
+			name:      "normal",
+			transform: testFlexTransform,
+			inTree: &v1.PersistentVolume{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "flexvol",
+				},
+				Spec: v1.PersistentVolumeSpec{
+					PersistentVolumeSource: v1.PersistentVolumeSource{
+						FlexVolume: &v1.FlexPersistentVolumeSource{
+							Driver:    testFlexDriverName,
+							FSType:    "xfs",
+							ReadOnly:  true,
+							SecretRef: secretRef,
+							Options:   map[string]string{"volumeID": "vg0/lv0"},
+						},
+					},
+				},
+			},
+			csi: &v1.PersistentVolume{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "flexvol",
+				},
+				Spec: v1.PersistentVolumeSpec{
+					PersistentVolumeSource: v1.PersistentVolumeSource{
+						CSI: &v1.CSIPersistentVolumeSource{
+							Driver:               testFlexCSIDriver,
+							VolumeHandle:         "vg0/lv0",
+							FSType:               "xfs",
+							ReadOnly:             true,
+							VolumeAttributes:     map[string]string{},
+							NodePublishSecretRef: secretRef,
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "empty volume handle",
+			transform: func(options map[string]string) (string, map[string]string, error) {
+				return "", options, nil
+			},
+			inTree: &v1.PersistentVolume{
+				Spec: v1.PersistentVolumeSpec{
+					PersistentVolumeSource: v1.PersistentVolumeSource{
+						FlexVolume: &v1.FlexPersistentVolumeSource{
+							Driver: testFlexDriverName,
+						},
+					},
+				},
+			},
+			errExpected: true,
+		},
+		{
+			name: "no transform",
+			inTree: &v1.PersistentVolume{
+				Spec: v1.PersistentVolumeSpec{
+					PersistentVolumeSource: v1.PersistentVolumeSource{
+						FlexVolume: &v1.FlexPersistentVolumeSource{
+							Driver: testFlexDriverName,
+						},
+					},
+				},
+			},
+			errExpected: true,
+		},
+		{
+			name:        "nil PV",
+			transform:   testFlexTransform,
+			errExpected: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Logf("Testing %v", tc.name)
+		translator := NewFlexVolumeCSITranslator(testFlexDriverName, testFlexCSIDriver, tc.transform, testFlexInverseTransform)
+		result, err := translator.TranslateInTreePVToCSI(tc.inTree)
+		if err != nil && !tc.errExpected {
+			t.Errorf("Did not expect error but got: %v", err)
+		}
+		if err == nil && tc.errExpected {
+			t.Errorf("Expected error, but did not get one.")
+		}
+		if !reflect.DeepEqual(result, tc.csi) {
+			t.Errorf("Got parameters: %v\n, expected :%v", result, tc.csi)
+		}
+	}
+}
+
+func TestTranslateFlexVolumeCSIPVToInTree(t *testing.T) {
+	testCases := []struct {
+		name             string
+		inverseTransform FlexVolumeOptionsInverseTransformFn
+		csi              *v1.PersistentVolume
+		inTree           *v1.PersistentVolume
+		errExpected      bool
+	}{
+		{
+			name:             "normal",
+			inverseTransform: testFlexInverseTransform,
+			csi: &v1.PersistentVolume{
+				Spec: v1.PersistentVolumeSpec{
+					PersistentVolumeSource: v1.PersistentVolumeSource{
+						CSI: &v1.CSIPersistentVolumeSource{
+							Driver:           testFlexCSIDriver,
+							VolumeHandle:     "vg0/lv0",
+							FSType:           "ext4",
+							VolumeAttributes: map[string]string{"size": "1G"},
+						},
+					},
+				},
+			},
+			inTree: &v1.PersistentVolume{
+				Spec: v1.PersistentVolumeSpec{
+					PersistentVolumeSource: v1.PersistentVolumeSource{
+						FlexVolume: &v1.FlexPersistentVolumeSource{
+							Driver:  testFlexDriverName,
+							FSType:  "ext4",
+							Options: map[string]string{"volumeID": "vg0/lv0", "size": "1G"},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "inverse transform error",
+			inverseTransform: func(volumeHandle string, attributes map[string]string) (map[string]string, error) {
+				return nil, fmt.Errorf("unknown volume group")
+			},
+			csi: &v1.PersistentVolume{
+				Spec: v1.PersistentVolumeSpec{
+					PersistentVolumeSource: v1.PersistentVolumeSource{
+						CSI: &v1.CSIPersistentVolumeSource{
+							Driver:       testFlexCSIDriver,
+							VolumeHandle: "vg0/lv0",
+						},
+					},
+				},
+			},
+			errExpected: true,
+		},
+		{
+			name: "no inverse transform",
+			csi: &v1.PersistentVolume{
+				Spec: v1.PersistentVolumeSpec{
+					PersistentVolumeSource: v1.PersistentVolumeSource{
+						CSI: &v1.CSIPersistentVolumeSource{
+							Driver:           testFlexCSIDriver,
+							VolumeHandle:     "vg0/lv0",
+							VolumeAttributes: map[string]string{"size": "1G"},
+						},
+					},
+				},
+			},
+			errExpected: true,
+		},
+		{
+			name:             "nil PV",
+			inverseTransform: testFlexInverseTransform,
+			errExpected:      true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Logf("Testing %v", tc.name)
+		translator := NewFlexVolumeCSITranslator(testFlexDriverName, testFlexCSIDriver, testFlexTransform, tc.inverseTransform)
+		result, err := translator.TranslateCSIPVToInTree(tc.csi)
+		if err != nil && !tc.errExpected {
+			t.Errorf("Did not expect error but got: %v", err)
+		}
+		if err == nil && tc.errExpected {
+			t.Errorf("Expected error, but did not get one.")
+		}
+		if !reflect.DeepEqual(result, tc.inTree) {
+			t.Errorf("Got parameters: %v\n, expected :%v", result, tc.inTree)
+		}
+	}
+}
+
+func TestTranslateFlexVolumeInTreeStorageClassToCSI(t *testing.T) {
+	translator := NewFlexVolumeCSITranslator(testFlexDriverName, testFlexCSIDriver, testFlexTransform, testFlexInverseTransform)
+
+	_, err := translator.TranslateInTreeStorageClassToCSI(NewStorageClass(map[string]string{"size": "1G"}, nil))
+	var scErr *ErrStorageClassNotSupported
+	if !errors.As(err, &scErr) {
+		t.Errorf("Expected ErrStorageClassNotSupported, got: %v", err)
+	}
+}
+
+func TestFlexVolumeCanSupport(t *testing.T) {
+	translator := NewFlexVolumeCSITranslator(testFlexDriverName, testFlexCSIDriver, testFlexTransform, testFlexInverseTransform)
+
+	if name := translator.GetInTreePluginName(); name != "flexvolume-example/lvm" {
+		t.Errorf("Got in-tree plugin name %s, expected flexvolume-example/lvm", name)
+	}
+	if !translator.CanSupportInline(&v1.Volume{VolumeSource: v1.VolumeSource{FlexVolume: &v1.FlexVolumeSource{Driver: testFlexDriverName}}}) {
+		t.Errorf("Expected inline volume of driver %s to be supported", testFlexDriverName)
+	}
+	if translator.CanSupport(&v1.PersistentVolume{Spec: v1.PersistentVolumeSpec{PersistentVolumeSource: v1.PersistentVolumeSource{FlexVolume: &v1.FlexPersistentVolumeSource{Driver: "other/driver"}}}}) {
+		t.Errorf("Did not expect PV of another FlexVolume driver to be supported")
+	}
+}
+
+func TestFlexVolumeRoundTrip(t *testing.T) {
+	translator := NewFlexVolumeCSITranslator(testFlexDriverName, testFlexCSIDriver, testFlexTransform, testFlexInverseTransform)
+	pv := &v1.PersistentVolume{
+		Spec: v1.PersistentVolumeSpec{
+			PersistentVolumeSource: v1.PersistentVolumeSource{
+				FlexVolume: &v1.FlexPersistentVolumeSource{
+					Driver:  testFlexDriverName,
+					Options: map[string]string{"volumeID": "vg0/lv0", "pool": "x"},
+				},
+			},
+		},
+	}
+
+	csiPV, err := translator.TranslateInTreePVToCSI(pv.DeepCopy())
+	if err != nil {
+		t.Fatalf("Error when translating to CSI: %v", err)
+	}
+	newPV, err := translator.TranslateCSIPVToInTree(csiPV)
+	if err != nil {
+		t.Fatalf("Error when translating CSI Source to in tree volume: %v", err)
+	}
+	if !reflect.DeepEqual(newPV, pv) {
+		t.Errorf("Volumes after translation and back not equal:\n\nOriginal Volume: %#v\n\nRound-trip Volume: %#v", pv, newPV)
+	}
+}
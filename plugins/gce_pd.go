@@ -18,6 +18,7 @@ package plugins
 
 import (
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
 
@@ -51,9 +52,23 @@ const (
 
 	// UnspecifiedValue is used for an unknown zone string
 	UnspecifiedValue = "UNSPECIFIED"
+
+	// diskEncryptionKMSKeyKey is the storage class parameter and CSI volume
+	// attribute holding the customer-managed encryption key of a disk
+	diskEncryptionKMSKeyKey = "disk-encryption-kms-key"
+	// gcePDDiskEncryptionKMSKeyAnnotation records the customer-managed
+	// encryption key on in-tree PVs, which have no field for it. It is
+	// prefixed with the name of the CSI driver, like CSIRBDVolHandleAnnKey,
+	// and only set on PVs translated back from CSI.
+	gcePDDiskEncryptionKMSKeyAnnotation = GCEPDDriverName + "/disk-encryption-kms-key"
 )
 
+// gceKMSKeyRegMatch represents Regex Match for a Cloud KMS key resource name
+// "projects/{project}/locations/{location}/keyRings/{keyRing}/cryptoKeys/{key}"
+var gceKMSKeyRegMatch = regexp.MustCompile("^projects/[^/]+/locations/[^/]+/keyRings/[^/]+/cryptoKeys/[^/]+$")
+
 var _ InTreePlugin = &gcePersistentDiskCSITranslator{}
+var _ CSIStorageClassTranslator = &gcePersistentDiskCSITranslator{}
 
 // gcePersistentDiskCSITranslator handles translation of PV spec from In-tree
 // GCE PD to CSI GCE PD and vice versa
@@ -92,6 +107,11 @@ func (g *gcePersistentDiskCSITranslator) TranslateInTreeStorageClassToCSI(sc *st
 			generatedTopologies = generateToplogySelectors(GCEPDTopologyKey, []string{v})
 		case zonesKey:
 			generatedTopologies = generateToplogySelectors(GCEPDTopologyKey, strings.Split(v, ","))
+		case diskEncryptionKMSKeyKey:
+			if err := validateGCEKMSKey(v); err != nil {
+				return nil, err
+			}
+			np[diskEncryptionKMSKeyKey] = v
 		default:
 			np[k] = v
 		}
@@ -114,6 +134,37 @@ func (g *gcePersistentDiskCSITranslator) TranslateInTreeStorageClassToCSI(sc *st
 	return sc, nil
 }
 
+// TranslateCSIStorageClassToInTree translates CSI GCE PD storage class
+// parameters to InTree storage class
+func (g *gcePersistentDiskCSITranslator) TranslateCSIStorageClassToInTree(sc *storage.StorageClass) (*storage.StorageClass, error) {
+	np := map[string]string{}
+	for k, v := range sc.Parameters {
+		switch strings.ToLower(k) {
+		case csiFsTypeKey:
+			np[fsTypeKey] = v
+		case diskEncryptionKMSKeyKey:
+			if err := validateGCEKMSKey(v); err != nil {
+				return nil, err
+			}
+			np[diskEncryptionKMSKeyKey] = v
+		default:
+			np[k] = v
+		}
+	}
+
+	if len(sc.AllowedTopologies) > 0 {
+		newTopologies, err := translateAllowedTopologiesToInTree(sc.AllowedTopologies, GCEPDTopologyKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed translating allowed topologies: %v", err)
+		}
+		sc.AllowedTopologies = newTopologies
+	}
+
+	sc.Parameters = np
+
+	return sc, nil
+}
+
 // backwardCompatibleAccessModes translates all instances of ReadWriteMany
 // access mode from the in-tree plugin to ReadWriteOnce. This is because in-tree
 // plugin never supported ReadWriteMany but also did not validate or enforce
@@ -238,6 +289,9 @@ func (g *gcePersistentDiskCSITranslator) TranslateInTreePVToCSI(pv *v1.Persisten
 	}
 
 	gceSource := pv.Spec.PersistentVolumeSource.GCEPersistentDisk
+	if err := validateWindowsPV(pv, gceSource.FSType); err != nil {
+		return nil, err
+	}
 
 	partition := ""
 	if gceSource.Partition != 0 {
@@ -254,6 +308,14 @@ func (g *gcePersistentDiskCSITranslator) TranslateInTreePVToCSI(pv *v1.Persisten
 		},
 	}
 
+	if kmsKey, ok := pv.Annotations[gcePDDiskEncryptionKMSKeyAnnotation]; ok {
+		if err := validateGCEKMSKey(kmsKey); err != nil {
+			return nil, err
+		}
+		csiSource.VolumeAttributes[diskEncryptionKMSKeyKey] = kmsKey
+		delete(pv.Annotations, gcePDDiskEncryptionKMSKeyAnnotation)
+	}
+
 	if err := translateTopologyFromInTreeToCSI(pv, GCEPDTopologyKey); err != nil {
 		return nil, fmt.Errorf("failed to translate topology: %v", err)
 	}
@@ -290,6 +352,15 @@ func (g *gcePersistentDiskCSITranslator) TranslateCSIPVToInTree(pv *v1.Persisten
 		}
 		gceSource.Partition = int32(partInt)
 	}
+	if kmsKey, ok := csiSource.VolumeAttributes[diskEncryptionKMSKeyKey]; ok {
+		if err := validateGCEKMSKey(kmsKey); err != nil {
+			return nil, err
+		}
+		if pv.Annotations == nil {
+			pv.Annotations = map[string]string{}
+		}
+		pv.Annotations[gcePDDiskEncryptionKMSKeyAnnotation] = kmsKey
+	}
 
 	// translate CSI topology to In-tree topology for rollback compatibility
 	if err := translateTopologyFromCSIToInTree(pv, GCEPDTopologyKey, gceGetRegionFromZones); err != nil {
@@ -369,6 +440,14 @@ func (g *gcePersistentDiskCSITranslator) RepairVolumeHandle(volumeHandle, nodeID
 	}
 }
 
+// validateGCEKMSKey checks that key is the resource name of a Cloud KMS key
+func validateGCEKMSKey(key string) error {
+	if !gceKMSKeyRegMatch.MatchString(key) {
+		return fmt.Errorf("invalid %s %q, expected format projects/{project}/locations/{location}/keyRings/{keyRing}/cryptoKeys/{key}", diskEncryptionKMSKeyKey, key)
+	}
+	return nil
+}
+
 func pdNameFromVolumeID(id string) (string, error) {
 	splitID := strings.Split(id, "/")
 	if len(splitID) < volIDTotalElements {
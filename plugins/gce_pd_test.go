@@ -33,6 +33,8 @@ func NewStorageClass(params map[string]string, allowedTopologies []v1.TopologySe
 	}
 }
 
+const testKMSKey = "projects/my-project/locations/us-central1/keyRings/my-ring/cryptoKeys/my-key"
+
 func TestTranslatePDInTreeStorageClassToCSI(t *testing.T) {
 	g := NewGCEPersistentDiskCSITranslator()
 
@@ -82,6 +84,16 @@ func TestTranslatePDInTreeStorageClassToCSI(t *testing.T) {
 			options: NewStorageClass(map[string]string{"zone": "foo"}, generateToplogySelectors(GCEPDTopologyKey, []string{"foo"})),
 			expErr:  true,
 		},
+		{
+			name:       "disk encryption kms key",
+			options:    NewStorageClass(map[string]string{"Disk-Encryption-KMS-Key": testKMSKey}, nil),
+			expOptions: NewStorageClass(map[string]string{"disk-encryption-kms-key": testKMSKey}, nil),
+		},
+		{
+			name:    "invalid disk encryption kms key",
+			options: NewStorageClass(map[string]string{"disk-encryption-kms-key": "projects/p/keyRings/r/cryptoKeys/k"}, nil),
+			expErr:  true,
+		},
 	}
 
 	for _, tc := range tcs {
@@ -99,6 +111,57 @@ func TestTranslatePDInTreeStorageClassToCSI(t *testing.T) {
 	}
 }
 
+func TestTranslatePDCSIStorageClassToInTree(t *testing.T) {
+	g := NewGCEPersistentDiskCSITranslator().(CSIStorageClassTranslator)
+
+	tcs := []struct {
+		name       string
+		options    *storage.StorageClass
+		expOptions *storage.StorageClass
+		expErr     bool
+	}{
+		{
+			name:       "nothing special",
+			options:    NewStorageClass(map[string]string{"foo": "bar"}, nil),
+			expOptions: NewStorageClass(map[string]string{"foo": "bar"}, nil),
+		},
+		{
+			name:       "fstype",
+			options:    NewStorageClass(map[string]string{"csi.storage.k8s.io/fstype": "myfs"}, nil),
+			expOptions: NewStorageClass(map[string]string{"fstype": "myfs"}, nil),
+		},
+		{
+			name:       "topology",
+			options:    NewStorageClass(map[string]string{}, generateToplogySelectors(GCEPDTopologyKey, []string{"foo"})),
+			expOptions: NewStorageClass(map[string]string{}, generateToplogySelectors(v1.LabelTopologyZone, []string{"foo"})),
+		},
+		{
+			name:       "disk encryption kms key",
+			options:    NewStorageClass(map[string]string{"disk-encryption-kms-key": testKMSKey}, nil),
+			expOptions: NewStorageClass(map[string]string{"disk-encryption-kms-key": testKMSKey}, nil),
+		},
+		{
+			name:    "invalid disk encryption kms key",
+			options: NewStorageClass(map[string]string{"disk-encryption-kms-key": "projects/p/keyRings/r/cryptoKeys/k"}, nil),
+			expErr:  true,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Logf("Testing %v", tc.name)
+		gotOptions, err := g.TranslateCSIStorageClassToInTree(tc.options)
+		if err != nil && !tc.expErr {
+			t.Errorf("Did not expect error but got: %v", err)
+		}
+		if err == nil && tc.expErr {
+			t.Errorf("Expected error, but did not get one.")
+		}
+		if !reflect.DeepEqual(gotOptions, tc.expOptions) {
+			t.Errorf("Got parameters: %v, expected :%v", gotOptions, tc.expOptions)
+		}
+	}
+}
+
 func TestRepairVolumeHandle(t *testing.T) {
 	testCases := []struct {
 		name                 string
@@ -353,3 +416,83 @@ func TestTranslateInTreePVToCSIVolIDFmt(t *testing.T) {
 		})
 	}
 }
+
+func TestTranslatePDDiskEncryptionKMSKey(t *testing.T) {
+	g := NewGCEPersistentDiskCSITranslator()
+
+	tcs := []struct {
+		name           string
+		annotations    map[string]string
+		expAttrs       map[string]string
+		expAnnotations map[string]string
+		expErr         bool
+	}{
+		{
+			name:     "no kms key",
+			expAttrs: map[string]string{"partition": ""},
+		},
+		{
+			name:           "kms key",
+			annotations:    map[string]string{gcePDDiskEncryptionKMSKeyAnnotation: testKMSKey},
+			expAttrs:       map[string]string{"partition": "", diskEncryptionKMSKeyKey: testKMSKey},
+			expAnnotations: map[string]string{},
+		},
+		{
+			name:           "kms key with other annotations",
+			annotations:    map[string]string{gcePDDiskEncryptionKMSKeyAnnotation: testKMSKey, "foo": "bar"},
+			expAttrs:       map[string]string{"partition": "", diskEncryptionKMSKeyKey: testKMSKey},
+			expAnnotations: map[string]string{"foo": "bar"},
+		},
+		{
+			name:        "kms key version",
+			annotations: map[string]string{gcePDDiskEncryptionKMSKeyAnnotation: testKMSKey + "/cryptoKeyVersions/1"},
+			expErr:      true,
+		},
+		{
+			name:        "empty kms key",
+			annotations: map[string]string{gcePDDiskEncryptionKMSKeyAnnotation: ""},
+			expErr:      true,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Logf("Testing %v", tc.name)
+		pv := &v1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{
+				Annotations: tc.annotations,
+			},
+			Spec: v1.PersistentVolumeSpec{
+				PersistentVolumeSource: v1.PersistentVolumeSource{
+					GCEPersistentDisk: &v1.GCEPersistentDiskVolumeSource{
+						PDName: "pd-name",
+					},
+				},
+			},
+		}
+		csiPV, err := g.TranslateInTreePVToCSI(pv.DeepCopy())
+		if err != nil && !tc.expErr {
+			t.Errorf("Did not expect error but got: %v", err)
+		}
+		if err == nil && tc.expErr {
+			t.Errorf("Expected error, but did not get one.")
+		}
+		if err != nil {
+			continue
+		}
+		if !reflect.DeepEqual(csiPV.Spec.CSI.VolumeAttributes, tc.expAttrs) {
+			t.Errorf("Got volume attributes: %v, expected: %v", csiPV.Spec.CSI.VolumeAttributes, tc.expAttrs)
+		}
+		if !reflect.DeepEqual(csiPV.Annotations, tc.expAnnotations) {
+			t.Errorf("Got CSI PV annotations: %v, expected: %v", csiPV.Annotations, tc.expAnnotations)
+		}
+
+		inTreePV, err := g.TranslateCSIPVToInTree(csiPV)
+		if err != nil {
+			t.Errorf("Error when translating CSI PV to in-tree: %v", err)
+			continue
+		}
+		if !reflect.DeepEqual(inTreePV.Annotations, tc.annotations) {
+			t.Errorf("Got annotations: %v, expected: %v", inTreePV.Annotations, tc.annotations)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugins
+
+import (
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	storage "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// GlusterfsInTreePluginName is the name of the in-tree plugin for GlusterFS
+	GlusterfsInTreePluginName = "kubernetes.io/glusterfs"
+
+	// Volume attributes set on the translated CSI source. There is no
+	// upstream GlusterFS CSI driver, so these describe the in-tree volume
+	// and it is up to the configured driver to consume them.
+	glusterfsEndpointsKey          = "endpoints"
+	glusterfsEndpointsNamespaceKey = "endpointsNamespace"
+	glusterfsPathKey               = "path"
+	// Storage class parameters of the in-tree heketi based provisioner that
+	// are reported when no CSI driver is configured
+	glusterfsRESTURLKey   = "resturl"
+	glusterfsClusterIDKey = "clusterid"
+
+	// glusterfsVolumeIDTemplate is "{namespace}#{endpoints}#{path}". Endpoints
+	// are namespaced, so the namespace is part of the handle to keep volumes
+	// of equally named endpoints apart.
+	glusterfsVolumeIDTemplate = "%s#%s#%s"
+)
+
+var _ InTreePlugin = &glusterfsCSITranslator{}
+
+// glusterfsCSITranslator handles translation of PV spec from In-tree GlusterFS
+// to a caller configured CSI driver and vice versa
+type glusterfsCSITranslator struct {
+	driverName string
+}
+
+// NewGlusterfsCSITranslator returns a new instance of glusterfsCSITranslator
+// translating to the CSI driver with the given name. If driverName is empty
+// every translation to CSI fails with an ErrNoCSIEquivalent.
+func NewGlusterfsCSITranslator(driverName string) InTreePlugin {
+	return &glusterfsCSITranslator{driverName: driverName}
+}
+
+// TranslateInTreeStorageClassToCSI takes in-tree storage class used by in-tree plugin
+// and translates them to a storage class consumable by CSI plugin
+func (g *glusterfsCSITranslator) TranslateInTreeStorageClassToCSI(sc *storage.StorageClass) (*storage.StorageClass, error) {
+	if sc == nil {
+		return nil, fmt.Errorf("sc is nil")
+	}
+	if g.driverName == "" {
+		details := map[string]string{}
+		for k, v := range sc.Parameters {
+			switch strings.ToLower(k) {
+			case glusterfsRESTURLKey, glusterfsClusterIDKey:
+				details[strings.ToLower(k)] = v
+			}
+		}
+		return nil, &ErrNoCSIEquivalent{InTreePluginName: GlusterfsInTreePluginName, Details: details}
+	}
+
+	params := map[string]string{}
+	for k, v := range sc.Parameters {
+		switch strings.ToLower(k) {
+		case fsTypeKey:
+			params[csiFsTypeKey] = v
+		default:
+			params[k] = v
+		}
+	}
+	sc.Provisioner = g.driverName
+	sc.Parameters = params
+	return sc, nil
+}
+
+// TranslateInTreeInlineVolumeToCSI takes a Volume with Glusterfs set from in-tree
+// and converts the Glusterfs source to a CSIPersistentVolumeSource
+func (g *glusterfsCSITranslator) TranslateInTreeInlineVolumeToCSI(volume *v1.Volume, podNamespace string) (*v1.PersistentVolume, error) {
+	if volume == nil || volume.Glusterfs == nil {
+		return nil, fmt.Errorf("volume is nil or Glusterfs not defined on volume")
+	}
+	glusterfsSource := volume.Glusterfs
+
+	// Inline endpoints always live in the pod namespace
+	attributes := map[string]string{
+		glusterfsEndpointsKey: glusterfsSource.EndpointsName,
+		glusterfsPathKey:      glusterfsSource.Path,
+	}
+	if podNamespace != "" {
+		attributes[glusterfsEndpointsNamespaceKey] = podNamespace
+	}
+	if g.driverName == "" {
+		return nil, &ErrNoCSIEquivalent{InTreePluginName: GlusterfsInTreePluginName, Details: attributes}
+	}
+
+	var am v1.PersistentVolumeAccessMode
+	if glusterfsSource.ReadOnly {
+		am = v1.ReadOnlyMany
+	} else {
+		am = v1.ReadWriteMany
+	}
+
+	volumeHandle := fmt.Sprintf(glusterfsVolumeIDTemplate, podNamespace, glusterfsSource.EndpointsName, glusterfsSource.Path)
+	pv := &v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{
+			// Must be unique per volume as it is used as the unique part of the
+			// staging path
+			Name: hashedInlinePVName(g.driverName, volumeHandle),
+		},
+		Spec: v1.PersistentVolumeSpec{
+			PersistentVolumeSource: v1.PersistentVolumeSource{
+				CSI: &v1.CSIPersistentVolumeSource{
+					Driver:           g.driverName,
+					VolumeHandle:     volumeHandle,
+					ReadOnly:         glusterfsSource.ReadOnly,
+					VolumeAttributes: attributes,
+				},
+			},
+			AccessModes: []v1.PersistentVolumeAccessMode{am},
+		},
+	}
+	return pv, nil
+}
+
+// TranslateInTreePVToCSI takes a PV with Glusterfs set from in-tree
+// and converts the Glusterfs source to a CSIPersistentVolumeSource
+func (g *glusterfsCSITranslator) TranslateInTreePVToCSI(pv *v1.PersistentVolume) (*v1.PersistentVolume, error) {
+	if pv == nil || pv.Spec.Glusterfs == nil {
+		return nil, fmt.Errorf("pv is nil or Glusterfs not defined on pv")
+	}
+	if isBlockVolume(pv) {
+		return nil, &ErrBlockVolumeNotSupported{InTreePluginName: GlusterfsInTreePluginName, Reason: "GlusterFS volumes can only be mounted as filesystem"}
+	}
+	glusterfsSource := pv.Spec.Glusterfs
+
+	attributes := map[string]string{
+		glusterfsEndpointsKey: glusterfsSource.EndpointsName,
+		glusterfsPathKey:      glusterfsSource.Path,
+	}
+	// Like the in-tree plugin, fall back to the namespace of the bound claim
+	endpointsNamespace := ""
+	if glusterfsSource.EndpointsNamespace != nil && *glusterfsSource.EndpointsNamespace != "" {
+		endpointsNamespace = *glusterfsSource.EndpointsNamespace
+	} else if pv.Spec.ClaimRef != nil {
+		endpointsNamespace = pv.Spec.ClaimRef.Namespace
+	}
+	if endpointsNamespace != "" {
+		attributes[glusterfsEndpointsNamespaceKey] = endpointsNamespace
+	}
+	if g.driverName == "" {
+		return nil, &ErrNoCSIEquivalent{InTreePluginName: GlusterfsInTreePluginName, Details: attributes}
+	}
+
+	csiSource := &v1.CSIPersistentVolumeSource{
+		Driver:           g.driverName,
+		VolumeHandle:     fmt.Sprintf(glusterfsVolumeIDTemplate, endpointsNamespace, glusterfsSource.EndpointsName, glusterfsSource.Path),
+		ReadOnly:         glusterfsSource.ReadOnly,
+		VolumeAttributes: attributes,
+	}
+
+	pv.Spec.Glusterfs = nil
+	pv.Spec.CSI = csiSource
+	return pv, nil
+}
+
+// TranslateCSIPVToInTree takes a PV with CSIPersistentVolumeSource set and
+// translates the CSI source to a Glusterfs source.
+func (g *glusterfsCSITranslator) TranslateCSIPVToInTree(pv *v1.PersistentVolume) (*v1.PersistentVolume, error) {
+	if pv == nil || pv.Spec.CSI == nil {
+		return nil, fmt.Errorf("pv is nil or CSI source not defined on pv")
+	}
+	if isBlockVolume(pv) {
+		return nil, &ErrBlockVolumeNotSupported{InTreePluginName: GlusterfsInTreePluginName, Reason: "GlusterFS volumes can only be mounted as filesystem"}
+	}
+	csiSource := pv.Spec.CSI
+
+	endpoints := csiSource.VolumeAttributes[glusterfsEndpointsKey]
+	path := csiSource.VolumeAttributes[glusterfsPathKey]
+	namespace := csiSource.VolumeAttributes[glusterfsEndpointsNamespaceKey]
+	if endpoints == "" || path == "" {
+		segments := strings.SplitN(csiSource.VolumeHandle, separator, 3)
+		if len(segments) != 3 {
+			return nil, fmt.Errorf("error parsing volume handle: %q, expected format {namespace}#{endpoints}#{path}", csiSource.VolumeHandle)
+		}
+		endpoints, path = segments[1], segments[2]
+		if namespace == "" {
+			namespace = segments[0]
+		}
+	}
+
+	glusterfsSource := &v1.GlusterfsPersistentVolumeSource{
+		EndpointsName: endpoints,
+		Path:          path,
+		ReadOnly:      csiSource.ReadOnly,
+	}
+	if namespace != "" {
+		glusterfsSource.EndpointsNamespace = &namespace
+	}
+
+	pv.Spec.CSI = nil
+	pv.Spec.Glusterfs = glusterfsSource
+	return pv, nil
+}
+
+// CanSupport tests whether the plugin supports a given persistent volume
+// specification from the API.
+func (g *glusterfsCSITranslator) CanSupport(pv *v1.PersistentVolume) bool {
+	return pv != nil && pv.Spec.Glusterfs != nil
+}
+
+// CanSupportInline tests whether the plugin supports a given inline volume
+// specification from the API.
+func (g *glusterfsCSITranslator) CanSupportInline(volume *v1.Volume) bool {
+	return volume != nil && volume.Glusterfs != nil
+}
+
+// GetInTreePluginName returns the name of the in-tree plugin driver
+func (g *glusterfsCSITranslator) GetInTreePluginName() string {
+	return GlusterfsInTreePluginName
+}
+
+// GetCSIPluginName returns the name of the configured CSI plugin, which is
+// empty if there is none
+func (g *glusterfsCSITranslator) GetCSIPluginName() string {
+	return g.driverName
+}
+
+// RepairVolumeHandle generates a correct volume handle based on node ID information.
+func (g *glusterfsCSITranslator) RepairVolumeHandle(volumeHandle, nodeID string) (string, error) {
+	return volumeHandle, nil
+}
@@ -0,0 +1,509 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugins
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	storage "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const testGlusterfsDriverName = "glusterfs.csi.example.com"
+
+func TestTranslateGlusterfsInTreeStorageClassToCSI(t *testing.T) {
+	testCases := []struct {
+		name          string
+		driverName    string
+		inTreeSC      *storage.StorageClass
+		csiSC         *storage.StorageClass
+		expNoCSIError *ErrNoCSIEquivalent
+		errorExp      bool
+	}{
+		{
+			name:       "configured driver",
+			driverName: testGlusterfsDriverName,
+			inTreeSC: &storage.StorageClass{
+				Provisioner: GlusterfsInTreePluginName,
+				Parameters: map[string]string{
+					"resturl": "http://heketi:8080",
+					"fsType":  "xfs",
+				},
+			},
+			csiSC: &storage.StorageClass{
+				Provisioner: testGlusterfsDriverName,
+				Parameters: map[string]string{
+					"resturl":    "http://heketi:8080",
+					csiFsTypeKey: "xfs",
+				},
+			},
+		},
+		{
+			name: "no driver",
+			inTreeSC: &storage.StorageClass{
+				Provisioner: GlusterfsInTreePluginName,
+				Parameters: map[string]string{
+					"restURL":   "http://heketi:8080",
+					"clusterid": "630372ccdc720a92c681fb928f27b53f",
+					"gidMin":    "40000",
+				},
+			},
+			expNoCSIError: &ErrNoCSIEquivalent{
+				InTreePluginName: GlusterfsInTreePluginName,
+				Details: map[string]string{
+					"resturl":   "http://heketi:8080",
+					"clusterid": "630372ccdc720a92c681fb928f27b53f",
+				},
+			},
+			errorExp: true,
+		},
+		{
+			name:       "nil, err expected",
+			driverName: testGlusterfsDriverName,
+			errorExp:   true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Logf("Testing %v", tc.name)
+		translator := NewGlusterfsCSITranslator(tc.driverName)
+		result, err := translator.TranslateInTreeStorageClassToCSI(tc.inTreeSC)
+		if err != nil && !tc.errorExp {
+			t.Errorf("Did not expect error but got: %v", err)
+		}
+		if err == nil && tc.errorExp {
+			t.Errorf("Expected error, but did not get one.")
+		}
+		if tc.expNoCSIError != nil {
+			var noCSIErr *ErrNoCSIEquivalent
+			if !errors.As(err, &noCSIErr) {
+				t.Errorf("Expected ErrNoCSIEquivalent, got: %v", err)
+			} else if !reflect.DeepEqual(noCSIErr, tc.expNoCSIError) {
+				t.Errorf("Got error: %#v\n, expected: %#v", noCSIErr, tc.expNoCSIError)
+			}
+		}
+		if !reflect.DeepEqual(result, tc.csiSC) {
+			t.Errorf("Got parameters: %v\n, expected :%v", result, tc.csiSC)
+		}
+	}
+}
+
+func TestTranslateGlusterfsInTreeInlineVolumeToCSI(t *testing.T) {
+	testCases := []struct {
+		name          string
+		driverName    string
+		inLine        *v1.Volume
+		csiVol        *v1.PersistentVolume
+		expNoCSIError *ErrNoCSIEquivalent
+		errExpected   bool
+	}{
+		{
+			name:       "configured driver",
+			driverName: testGlusterfsDriverName,
+			inLine: &v1.Volume{
+				Name: "glustervol",
+				VolumeSource: v1.VolumeSource{
+					Glusterfs: &v1.GlusterfsVolumeSource{
+						EndpointsName: "glusterfs-cluster",
+						Path:          "kube_vol",
+						ReadOnly:      true,
+					},
+				},
+			},
+			csiVol: &v1.PersistentVolume{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: hashedInlinePVName(testGlusterfsDriverName, "ns#glusterfs-cluster#kube_vol"),
+				},
+				Spec: v1.PersistentVolumeSpec{
+					PersistentVolumeSource: v1.PersistentVolumeSource{
+						CSI: &v1.CSIPersistentVolumeSource{
+							Driver:       testGlusterfsDriverName,
+							VolumeHandle: "ns#glusterfs-cluster#kube_vol",
+							ReadOnly:     true,
+							VolumeAttributes: map[string]string{
+								glusterfsEndpointsKey:          "glusterfs-cluster",
+								glusterfsEndpointsNamespaceKey: "ns",
+								glusterfsPathKey:               "kube_vol",
+							},
+						},
+					},
+					AccessModes: []v1.PersistentVolumeAccessMode{v1.ReadOnlyMany},
+				},
+			},
+		},
+		{
+			name: "no driver",
+			inLine: &v1.Volume{
+				Name: "glustervol",
+				VolumeSource: v1.VolumeSource{
+					Glusterfs: &v1.GlusterfsVolumeSource{
+						EndpointsName: "glusterfs-cluster",
+						Path:          "kube_vol",
+					},
+				},
+			},
+			expNoCSIError: &ErrNoCSIEquivalent{
+				InTreePluginName: GlusterfsInTreePluginName,
+				Details: map[string]string{
+					glusterfsEndpointsKey:          "glusterfs-cluster",
+					glusterfsEndpointsNamespaceKey: "ns",
+					glusterfsPathKey:               "kube_vol",
+				},
+			},
+			errExpected: true,
+		},
+		{
+			name:        "nil",
+			driverName:  testGlusterfsDriverName,
+			errExpected: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Logf("Testing %v", tc.name)
+		translator := NewGlusterfsCSITranslator(tc.driverName)
+		result, err := translator.TranslateInTreeInlineVolumeToCSI(tc.inLine, "ns")
+		if err != nil && !tc.errExpected {
+			t.Errorf("Did not expect error but got: %v", err)
+		}
+		if err == nil && tc.errExpected {
+			t.Errorf("Expected error, but did not get one.")
+		}
+		if tc.expNoCSIError != nil {
+			var noCSIErr *ErrNoCSIEquivalent
+			if !errors.As(err, &noCSIErr) {
+				t.Errorf("Expected ErrNoCSIEquivalent, got: %v", err)
+			} else if !reflect.DeepEqual(noCSIErr, tc.expNoCSIError) {
+				t.Errorf("Got error: %#v\n, expected: %#v", noCSIErr, tc.expNoCSIError)
+			}
+		}
+		if !reflect.DeepEqual(result, tc.csiVol) {
+			t.Errorf("Got parameters: %v\n, expected :%v", result, tc.csiVol)
+		}
+	}
+}
+
+func TestGlusterfsInlinePVName(t *testing.T) {
+	translator := NewGlusterfsCSITranslator(testGlusterfsDriverName)
+	names := map[string]bool{}
+	for _, tc := range []struct {
+		namespace string
+		path      string
+	}{
+		{namespace: "ns", path: "kube_vol"},
+		{namespace: "ns", path: "kube_vol/subdir"},
+		{namespace: "ns", path: "kube_vol/subdir/nested"},
+		{namespace: "other-ns", path: "kube_vol"},
+	} {
+		t.Logf("Testing %v/%v", tc.namespace, tc.path)
+		pv, err := translator.TranslateInTreeInlineVolumeToCSI(&v1.Volume{
+			VolumeSource: v1.VolumeSource{
+				Glusterfs: &v1.GlusterfsVolumeSource{
+					EndpointsName: "glusterfs-cluster",
+					Path:          tc.path,
+				},
+			},
+		}, tc.namespace)
+		if err != nil {
+			t.Fatalf("Error when translating to CSI: %v", err)
+		}
+		if errs := validation.IsDNS1123Subdomain(pv.Name); len(errs) > 0 {
+			t.Errorf("Invalid PV name %q: %v", pv.Name, errs)
+		}
+		if names[pv.Name] {
+			t.Errorf("PV name %q is not unique", pv.Name)
+		}
+		names[pv.Name] = true
+	}
+}
+
+func TestTranslateGlusterfsInTreePVToCSI(t *testing.T) {
+	endpointsNamespace := "gluster"
+	blockVolumeMode := v1.PersistentVolumeBlock
+
+	testCases := []struct {
+		name          string
+		driverName    string
+		inTree        *v1.PersistentVolume
+		csi           *v1.PersistentVolume
+		expNoCSIError *ErrNoCSIEquivalent
+		expBlockError bool
+		errExpected   bool
+	}{
+		{
+			name:       "configured driver",
+			driverName: testGlusterfsDriverName,
+			inTree: &v1.PersistentVolume{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "glusterfs",
+				},
+				Spec: v1.PersistentVolumeSpec{
+					PersistentVolumeSource: v1.PersistentVolumeSource{
+						Glusterfs: &v1.GlusterfsPersistentVolumeSource{
+							EndpointsName:      "glusterfs-cluster",
+							Path:               "kube_vol",
+							EndpointsNamespace: &endpointsNamespace,
+						},
+					},
+					AccessModes: []v1.PersistentVolumeAccessMode{v1.ReadWriteMany},
+				},
+			},
+			csi: &v1.PersistentVolume{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "glusterfs",
+				},
+				Spec: v1.PersistentVolumeSpec{
+					PersistentVolumeSource: v1.PersistentVolumeSource{
+						CSI: &v1.CSIPersistentVolumeSource{
+							Driver:       testGlusterfsDriverName,
+							VolumeHandle: "gluster#glusterfs-cluster#kube_vol",
+							VolumeAttributes: map[string]string{
+								glusterfsEndpointsKey:          "glusterfs-cluster",
+								glusterfsEndpointsNamespaceKey: "gluster",
+								glusterfsPathKey:               "kube_vol",
+							},
+						},
+					},
+					AccessModes: []v1.PersistentVolumeAccessMode{v1.ReadWriteMany},
+				},
+			},
+		},
+		{
+			name:       "endpoints namespace of bound claim",
+			driverName: testGlusterfsDriverName,
+			inTree: &v1.PersistentVolume{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "glusterfs",
+				},
+				Spec: v1.PersistentVolumeSpec{
+					PersistentVolumeSource: v1.PersistentVolumeSource{
+						Glusterfs: &v1.GlusterfsPersistentVolumeSource{
+							EndpointsName: "glusterfs-cluster",
+							Path:          "kube_vol",
+						},
+					},
+					ClaimRef: &v1.ObjectReference{
+						Name:      "claim",
+						Namespace: "claim-ns",
+					},
+				},
+			},
+			csi: &v1.PersistentVolume{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "glusterfs",
+				},
+				Spec: v1.PersistentVolumeSpec{
+					PersistentVolumeSource: v1.PersistentVolumeSource{
+						CSI: &v1.CSIPersistentVolumeSource{
+							Driver:       testGlusterfsDriverName,
+							VolumeHandle: "claim-ns#glusterfs-cluster#kube_vol",
+							VolumeAttributes: map[string]string{
+								glusterfsEndpointsKey:          "glusterfs-cluster",
+								glusterfsEndpointsNamespaceKey: "claim-ns",
+								glusterfsPathKey:               "kube_vol",
+							},
+						},
+					},
+					ClaimRef: &v1.ObjectReference{
+						Name:      "claim",
+						Namespace: "claim-ns",
+					},
+				},
+			},
+		},
+		{
+			name: "no driver",
+			inTree: &v1.PersistentVolume{
+				Spec: v1.PersistentVolumeSpec{
+					PersistentVolumeSource: v1.PersistentVolumeSource{
+						Glusterfs: &v1.GlusterfsPersistentVolumeSource{
+							EndpointsName: "glusterfs-cluster",
+							Path:          "kube_vol",
+						},
+					},
+					ClaimRef: &v1.ObjectReference{
+						Name:      "claim",
+						Namespace: "claim-ns",
+					},
+				},
+			},
+			expNoCSIError: &ErrNoCSIEquivalent{
+				InTreePluginName: GlusterfsInTreePluginName,
+				Details: map[string]string{
+					glusterfsEndpointsKey:          "glusterfs-cluster",
+					glusterfsEndpointsNamespaceKey: "claim-ns",
+					glusterfsPathKey:               "kube_vol",
+				},
+			},
+			errExpected: true,
+		},
+		{
+			name:       "block volume",
+			driverName: testGlusterfsDriverName,
+			inTree: &v1.PersistentVolume{
+				Spec: v1.PersistentVolumeSpec{
+					PersistentVolumeSource: v1.PersistentVolumeSource{
+						Glusterfs: &v1.GlusterfsPersistentVolumeSource{
+							EndpointsName: "glusterfs-cluster",
+							Path:          "kube_vol",
+						},
+					},
+					VolumeMode: &blockVolumeMode,
+				},
+			},
+			expBlockError: true,
+			errExpected:   true,
+		},
+		{
+			name:        "nil PV",
+			driverName:  testGlusterfsDriverName,
+			errExpected: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Logf("Testing %v", tc.name)
+		translator := NewGlusterfsCSITranslator(tc.driverName)
+		result, err := translator.TranslateInTreePVToCSI(tc.inTree)
+		if err != nil && !tc.errExpected {
+			t.Errorf("Did not expect error but got: %v", err)
+		}
+		if err == nil && tc.errExpected {
+			t.Errorf("Expected error, but did not get one.")
+		}
+		if tc.expNoCSIError != nil {
+			var noCSIErr *ErrNoCSIEquivalent
+			if !errors.As(err, &noCSIErr) {
+				t.Errorf("Expected ErrNoCSIEquivalent, got: %v", err)
+			} else if !reflect.DeepEqual(noCSIErr, tc.expNoCSIError) {
+				t.Errorf("Got error: %#v\n, expected: %#v", noCSIErr, tc.expNoCSIError)
+			}
+		}
+		if tc.expBlockError {
+			var blockErr *ErrBlockVolumeNotSupported
+			if !errors.As(err, &blockErr) {
+				t.Errorf("Expected ErrBlockVolumeNotSupported, got: %v", err)
+			}
+		}
+		if !reflect.DeepEqual(result, tc.csi) {
+			t.Errorf("Got parameters: %v\n, expected :%v", result, tc.csi)
+		}
+	}
+}
+
+func TestTranslateGlusterfsCSIPVToInTree(t *testing.T) {
+	translator := NewGlusterfsCSITranslator(testGlusterfsDriverName)
+	endpointsNamespace := "gluster"
+
+	testCases := []struct {
+		name        string
+		csi         *v1.PersistentVolume
+		inTree      *v1.PersistentVolume
+		errExpected bool
+	}{
+		{
+			name: "volume attributes",
+			csi: &v1.PersistentVolume{
+				Spec: v1.PersistentVolumeSpec{
+					PersistentVolumeSource: v1.PersistentVolumeSource{
+						CSI: &v1.CSIPersistentVolumeSource{
+							Driver:       testGlusterfsDriverName,
+							VolumeHandle: "gluster#glusterfs-cluster#kube_vol",
+							VolumeAttributes: map[string]string{
+								glusterfsEndpointsKey:          "glusterfs-cluster",
+								glusterfsEndpointsNamespaceKey: "gluster",
+								glusterfsPathKey:               "kube_vol",
+							},
+						},
+					},
+				},
+			},
+			inTree: &v1.PersistentVolume{
+				Spec: v1.PersistentVolumeSpec{
+					PersistentVolumeSource: v1.PersistentVolumeSource{
+						Glusterfs: &v1.GlusterfsPersistentVolumeSource{
+							EndpointsName:      "glusterfs-cluster",
+							Path:               "kube_vol",
+							EndpointsNamespace: &endpointsNamespace,
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "volume handle only",
+			csi: &v1.PersistentVolume{
+				Spec: v1.PersistentVolumeSpec{
+					PersistentVolumeSource: v1.PersistentVolumeSource{
+						CSI: &v1.CSIPersistentVolumeSource{
+							Driver:       testGlusterfsDriverName,
+							VolumeHandle: "gluster#glusterfs-cluster#kube_vol",
+							ReadOnly:     true,
+						},
+					},
+				},
+			},
+			inTree: &v1.PersistentVolume{
+				Spec: v1.PersistentVolumeSpec{
+					PersistentVolumeSource: v1.PersistentVolumeSource{
+						Glusterfs: &v1.GlusterfsPersistentVolumeSource{
+							EndpointsName:      "glusterfs-cluster",
+							Path:               "kube_vol",
+							EndpointsNamespace: &endpointsNamespace,
+							ReadOnly:           true,
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "malformed volume handle",
+			csi: &v1.PersistentVolume{
+				Spec: v1.PersistentVolumeSpec{
+					PersistentVolumeSource: v1.PersistentVolumeSource{
+						CSI: &v1.CSIPersistentVolumeSource{
+							Driver:       testGlusterfsDriverName,
+							VolumeHandle: "kube_vol",
+						},
+					},
+				},
+			},
+			errExpected: true,
+		},
+		{
+			name:        "nil PV",
+			errExpected: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Logf("Testing %v", tc.name)
+		result, err := translator.TranslateCSIPVToInTree(tc.csi)
+		if err != nil && !tc.errExpected {
+			t.Errorf("Did not expect error but got: %v", err)
+		}
+		if err == nil && tc.errExpected {
+			t.Errorf("Expected error, but did not get one.")
+		}
+		if !reflect.DeepEqual(result, tc.inTree) {
+			t.Errorf("Got parameters: %v\n, expected :%v", result, tc.inTree)
+		}
+	}
+}
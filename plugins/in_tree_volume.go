@@ -17,6 +17,7 @@ limitations under the License.
 package plugins
 
 import (
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"sort"
@@ -67,6 +68,16 @@ type InTreePlugin interface {
 	RepairVolumeHandle(volumeHandle, nodeID string) (string, error)
 }
 
+// CSIStorageClassTranslator is implemented by in-tree plugins that can
+// translate storage classes of their CSI driver back to in-tree, e.g. to roll
+// back a migration
+type CSIStorageClassTranslator interface {
+	// TranslateCSIStorageClassToInTree takes CSI storage class parameters and
+	// translates them to parameters consumable by the in-tree plugin. The
+	// input storage class can be modified
+	TranslateCSIStorageClassToInTree(sc *storage.StorageClass) (*storage.StorageClass, error)
+}
+
 const (
 	// fsTypeKey is the deprecated storage class parameter key for fstype
 	fsTypeKey = "fstype"
@@ -76,8 +87,129 @@ const (
 	zoneKey = "zone"
 	// zonesKey is the deprecated storage class parameter key for zones
 	zonesKey = "zones"
+	// ntfsFSType is the filesystem used by volumes attached to Windows nodes
+	ntfsFSType = "ntfs"
+	// windowsOS is the value of the kubernetes.io/os label of Windows nodes
+	windowsOS = "windows"
+)
+
+// linuxOnlyMountOptions are mount options only understood by Linux mounts
+// (cifs or block device filesystems). csi-proxy does not accept them when
+// mounting a volume on a Windows node.
+var linuxOnlyMountOptions = sets.NewString(
+	"uid", "gid", "file_mode", "dir_mode", "vers", "sec", "cache", "actimeo",
+	"nobrl", "mfsymlinks", "noperm", "serverino", "noserverino",
+	"discard", "noatime", "nodiratime", "nobarrier", "data",
 )
 
+// ErrNoCSIEquivalent is returned by plugins whose in-tree volumes have no CSI
+// driver to be translated to. Details carries the in-tree volume information
+// needed to migrate the volume manually.
+type ErrNoCSIEquivalent struct {
+	// InTreePluginName is the name of the in-tree plugin that could not be translated
+	InTreePluginName string
+	// Details holds plugin specific information about the volume, e.g. endpoints and path
+	Details map[string]string
+}
+
+func (e *ErrNoCSIEquivalent) Error() string {
+	return fmt.Sprintf("in-tree plugin %s has no CSI equivalent, manual migration required: %v", e.InTreePluginName, e.Details)
+}
+
+// ErrBlockVolumeNotSupported is returned when a PV in Block volumeMode cannot
+// be translated because the CSI driver superseding the plugin only supports
+// filesystem volumes.
+type ErrBlockVolumeNotSupported struct {
+	// InTreePluginName is the name of the in-tree plugin of the volume
+	InTreePluginName string
+	// Reason describes why the block volume cannot be translated
+	Reason string
+}
+
+func (e *ErrBlockVolumeNotSupported) Error() string {
+	return fmt.Sprintf("block volume mode is not supported for in-tree plugin %s: %s", e.InTreePluginName, e.Reason)
+}
+
+// ErrStorageClassNotSupported is returned when translating a storage class
+// of an in-tree plugin that cannot be dynamically provisioned.
+type ErrStorageClassNotSupported struct {
+	// InTreePluginName is the name of the in-tree plugin of the storage class
+	InTreePluginName string
+}
+
+func (e *ErrStorageClassNotSupported) Error() string {
+	return fmt.Sprintf("in-tree plugin %s does not support dynamic provisioning", e.InTreePluginName)
+}
+
+// ErrUnsupportedParameters is returned when a volume or storage class uses
+// parameters, or a combination of them, that the in-tree plugin supports but
+// the CSI driver superseding it does not.
+type ErrUnsupportedParameters struct {
+	// InTreePluginName is the name of the in-tree plugin of the volume
+	InTreePluginName string
+	// Parameters are the unsupported parameters and their values
+	Parameters map[string]string
+	// Reason describes why the parameters are not supported
+	Reason string
+}
+
+func (e *ErrUnsupportedParameters) Error() string {
+	return fmt.Sprintf("parameters %v of in-tree plugin %s are not supported by its CSI driver: %s", e.Parameters, e.InTreePluginName, e.Reason)
+}
+
+// isBlockVolume tests whether the PV is in Block volumeMode
+func isBlockVolume(pv *v1.PersistentVolume) bool {
+	return pv.Spec.VolumeMode != nil && *pv.Spec.VolumeMode == v1.PersistentVolumeBlock
+}
+
+// hashedInlinePVName returns the name of the PV of an inline volume whose
+// volume handle may contain characters not allowed in an object name, e.g.
+// '#' or '/'. The handle is hashed, keeping the name unique per volume as it
+// is used as the unique part of the staging path.
+func hashedInlinePVName(driverName, volumeHandle string) string {
+	return fmt.Sprintf("%s-%x", driverName, sha256.Sum256([]byte(volumeHandle)))
+}
+
+// getNodeAffinityOS returns the operating systems the PV NodeAffinity
+// restricts it to, or nil if it is not restricted
+func getNodeAffinityOS(pv *v1.PersistentVolume) []string {
+	return getTopologyValues(pv, v1.LabelOSStable)
+}
+
+// validateWindowsPV checks that a PV targeted at Windows nodes, either by
+// its NodeAffinity or by using ntfs, has a fsType and mount options that can
+// be used on Windows and that ntfs is not used on PVs restricted to other
+// operating systems.
+func validateWindowsPV(pv *v1.PersistentVolume, fsType string) error {
+	isNTFS := strings.EqualFold(fsType, ntfsFSType)
+	windows := isNTFS
+	if osValues := getNodeAffinityOS(pv); len(osValues) > 0 {
+		windows = len(osValues) == 1 && osValues[0] == windowsOS
+		if isNTFS && !windows {
+			return fmt.Errorf("fsType %s is only supported on Windows nodes, pv is restricted to %v nodes", fsType, osValues)
+		}
+	}
+	if !windows {
+		return nil
+	}
+	if fsType != "" && !isNTFS {
+		return fmt.Errorf("fsType %s is not supported on Windows nodes", fsType)
+	}
+	for _, option := range pv.Spec.MountOptions {
+		key := strings.SplitN(option, "=", 2)[0]
+		if linuxOnlyMountOptions.Has(strings.ToLower(strings.TrimSpace(key))) {
+			return fmt.Errorf("mount option %q is not supported on Windows nodes", option)
+		}
+	}
+	return nil
+}
+
+// isWindowsPV tests whether the PV NodeAffinity restricts it to Windows nodes
+func isWindowsPV(pv *v1.PersistentVolume) bool {
+	osValues := getNodeAffinityOS(pv)
+	return len(osValues) == 1 && osValues[0] == windowsOS
+}
+
 // replaceTopology overwrites an existing key in NodeAffinity by a new one.
 // If there are any newKey already exist in an expression of a term, we will
 // not combine the replaced key Values with the existing ones.
@@ -334,6 +466,31 @@ func translateAllowedTopologies(terms []v1.TopologySelectorTerm, key string) ([]
 	return newTopologies, nil
 }
 
+// translateAllowedTopologiesToInTree translates allowed topologies of the CSI
+// driver with the given zonal topology key to the GA kubernetes zone label
+func translateAllowedTopologiesToInTree(terms []v1.TopologySelectorTerm, key string) ([]v1.TopologySelectorTerm, error) {
+	if terms == nil {
+		return nil, nil
+	}
+
+	newTopologies := []v1.TopologySelectorTerm{}
+	for _, term := range terms {
+		newTerm := v1.TopologySelectorTerm{}
+		for _, exp := range term.MatchLabelExpressions {
+			newExp := exp
+			if exp.Key == key {
+				newExp = v1.TopologySelectorLabelRequirement{
+					Key:    v1.LabelTopologyZone,
+					Values: exp.Values,
+				}
+			}
+			newTerm.MatchLabelExpressions = append(newTerm.MatchLabelExpressions, newExp)
+		}
+		newTopologies = append(newTopologies, newTerm)
+	}
+	return newTopologies, nil
+}
+
 // regionTopologyHandler will process the PV and add region
 // kubernetes topology label to its NodeAffinity and labels
 // It assumes the Zone NodeAffinity already exists
@@ -25,6 +25,36 @@ import (
 )
 
 var (
+	windowsNodeAffinity = &v1.VolumeNodeAffinity{
+		Required: &v1.NodeSelector{
+			NodeSelectorTerms: []v1.NodeSelectorTerm{
+				{
+					MatchExpressions: []v1.NodeSelectorRequirement{
+						{
+							Key:      v1.LabelOSStable,
+							Operator: v1.NodeSelectorOpIn,
+							Values:   []string{"windows"},
+						},
+					},
+				},
+			},
+		},
+	}
+	linuxNodeAffinity = &v1.VolumeNodeAffinity{
+		Required: &v1.NodeSelector{
+			NodeSelectorTerms: []v1.NodeSelectorTerm{
+				{
+					MatchExpressions: []v1.NodeSelectorRequirement{
+						{
+							Key:      v1.LabelOSStable,
+							Operator: v1.NodeSelectorOpIn,
+							Values:   []string{"linux"},
+						},
+					},
+				},
+			},
+		},
+	}
 	useast1aGALabels = map[string]string{
 		v1.LabelTopologyZone:   "us-east1-a",
 		v1.LabelTopologyRegion: "us-east1",
@@ -951,6 +981,81 @@ func TestReplaceTopology(t *testing.T) {
 	}
 }
 
+func TestValidateWindowsPV(t *testing.T) {
+	testCases := []struct {
+		name         string
+		fsType       string
+		nodeAffinity *v1.VolumeNodeAffinity
+		mountOptions []string
+		expErr       bool
+	}{
+		{
+			name:         "linux volume with linux mount options",
+			fsType:       "ext4",
+			mountOptions: []string{"noatime", "discard"},
+		},
+		{
+			name:   "ntfs without node affinity",
+			fsType: "ntfs",
+		},
+		{
+			name:         "NTFS on windows",
+			fsType:       "NTFS",
+			nodeAffinity: windowsNodeAffinity,
+		},
+		{
+			name:         "ntfs on linux",
+			fsType:       "ntfs",
+			nodeAffinity: linuxNodeAffinity,
+			expErr:       true,
+		},
+		{
+			name:         "ext4 on windows",
+			fsType:       "ext4",
+			nodeAffinity: windowsNodeAffinity,
+			expErr:       true,
+		},
+		{
+			name:         "no fsType on windows",
+			nodeAffinity: windowsNodeAffinity,
+		},
+		{
+			name:         "ntfs with linux mount options",
+			fsType:       "ntfs",
+			mountOptions: []string{"nobarrier"},
+			expErr:       true,
+		},
+		{
+			name:         "windows with linux mount options",
+			nodeAffinity: windowsNodeAffinity,
+			mountOptions: []string{"uid=1000"},
+			expErr:       true,
+		},
+		{
+			name:         "windows with other mount options",
+			nodeAffinity: windowsNodeAffinity,
+			mountOptions: []string{"ro"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Logf("Testing %v", tc.name)
+		pv := &v1.PersistentVolume{
+			Spec: v1.PersistentVolumeSpec{
+				MountOptions: tc.mountOptions,
+				NodeAffinity: tc.nodeAffinity,
+			},
+		}
+		err := validateWindowsPV(pv, tc.fsType)
+		if err != nil && !tc.expErr {
+			t.Errorf("Did not expect error but got: %v", err)
+		}
+		if err == nil && tc.expErr {
+			t.Errorf("Expected error, but did not get one.")
+		}
+	}
+}
+
 func makePVWithNodeSelectorTerms(nodeSelectorTerms []v1.NodeSelectorTerm) *v1.PersistentVolume {
 	return &v1.PersistentVolume{
 		Spec: v1.PersistentVolumeSpec{
@@ -145,6 +145,9 @@ func (t *vSphereCSITranslator) TranslateInTreePVToCSI(pv *v1.PersistentVolume) (
 	if pv == nil || pv.Spec.VsphereVolume == nil {
 		return nil, fmt.Errorf("pv is nil or VsphereVolume not defined on pv")
 	}
+	if err := validateWindowsPV(pv, pv.Spec.VsphereVolume.FSType); err != nil {
+		return nil, err
+	}
 	csiSource := &v1.CSIPersistentVolumeSource{
 		Driver:           VSphereDriverName,
 		VolumeHandle:     pv.Spec.VsphereVolume.VolumePath,
@@ -19,12 +19,19 @@ package csitranslation
 import (
 	"errors"
 	"fmt"
+	"sort"
 
 	v1 "k8s.io/api/core/v1"
 	storage "k8s.io/api/storage/v1"
 	"k8s.io/csi-translation-lib/plugins"
 )
 
+const (
+	// ResizerAnnotationKey is the PVC annotation naming the in-tree plugin or
+	// CSI driver responsible for an in-flight volume expansion
+	ResizerAnnotationKey = "volume.kubernetes.io/storage-resizer"
+)
+
 var (
 	inTreePlugins = map[string]plugins.InTreePlugin{
 		plugins.GCEPDDriverName:     plugins.NewGCEPersistentDiskCSITranslator(),
@@ -36,12 +43,84 @@ var (
 		plugins.PortworxDriverName:  plugins.NewPortworxCSITranslator(),
 		plugins.RBDDriverName:       plugins.NewRBDCSITranslator(),
 	}
+
+	// noCSIEquivalentPlugins are in-tree plugins that are only migratable when
+	// the caller configures a CSI driver for them. Until then they are used to
+	// report an ErrNoCSIEquivalent instead of a generic error.
+	noCSIEquivalentPlugins = []plugins.InTreePlugin{
+		plugins.NewGlusterfsCSITranslator(""),
+	}
 )
 
 // CSITranslator translates in-tree storage API objects to their equivalent CSI
 // API objects. It also provides many helper functions to determine whether
 // translation logic exists and the mappings between "in-tree plugin <-> csi driver"
-type CSITranslator struct{}
+type CSITranslator struct {
+	// plugins maps CSI driver names to the in-tree plugins they supersede.
+	// It is nil for a zero CSITranslator, in which case the default
+	// inTreePlugins are used.
+	plugins map[string]plugins.InTreePlugin
+	// cache holds in-tree PV to CSI translations, it is nil if caching is disabled
+	cache *translationCache
+}
+
+// Option configures a CSITranslator created by NewWithOptions
+type Option func(*CSITranslator) error
+
+// WithGlusterfsCSIDriverName makes GlusterFS volumes migratable to the CSI
+// driver with the given name. Without it, or with an empty driverName,
+// GlusterFS translations fail with an ErrNoCSIEquivalent.
+func WithGlusterfsCSIDriverName(driverName string) Option {
+	return func(t *CSITranslator) error {
+		if driverName == "" {
+			return nil
+		}
+		return t.registerPlugin(driverName, plugins.NewGlusterfsCSITranslator(driverName))
+	}
+}
+
+// WithFlexVolumeDrivers makes volumes of the FlexVolume drivers in
+// driverNames migratable to the CSI drivers they are mapped to. The mapping
+// must be one-to-one. transform computes the CSI volume handle and
+// attributes from the FlexVolume options and inverseTransform the options
+// back from them, both are required.
+func WithFlexVolumeDrivers(driverNames map[string]string, transform plugins.FlexVolumeOptionsTransformFn, inverseTransform plugins.FlexVolumeOptionsInverseTransformFn) Option {
+	return func(t *CSITranslator) error {
+		if transform == nil || inverseTransform == nil {
+			return fmt.Errorf("FlexVolume drivers require both an options transform and an inverse transform")
+		}
+		flexDriverNames := make(map[string]string, len(driverNames))
+		for flexDriverName, csiDriverName := range driverNames {
+			if csiDriverName == "" {
+				return fmt.Errorf("FlexVolume driver %s is mapped to an empty CSI driver name", flexDriverName)
+			}
+			if otherFlexDriverName, ok := flexDriverNames[csiDriverName]; ok {
+				names := []string{flexDriverName, otherFlexDriverName}
+				sort.Strings(names)
+				return fmt.Errorf("FlexVolume drivers %s and %s are both mapped to CSI driver %s", names[0], names[1], csiDriverName)
+			}
+			flexDriverNames[csiDriverName] = flexDriverName
+		}
+		for csiDriverName, flexDriverName := range flexDriverNames {
+			if err := t.registerPlugin(csiDriverName, plugins.NewFlexVolumeCSITranslator(flexDriverName, csiDriverName, transform, inverseTransform)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// WithTranslationCache caches up to size translations of in-tree PVs to CSI.
+// Translating a PV with the same UID and resourceVersion again returns a copy
+// of the cached translation. A size of zero or less disables caching.
+func WithTranslationCache(size int) Option {
+	return func(t *CSITranslator) error {
+		if size > 0 {
+			t.cache = newTranslationCache(size)
+		}
+		return nil
+	}
+}
 
 // New creates a new CSITranslator which does real translation
 // for "in-tree plugins <-> csi drivers"
@@ -49,11 +128,51 @@ func New() CSITranslator {
 	return CSITranslator{}
 }
 
+// NewWithOptions creates a new CSITranslator like New and configures it with
+// opts. It fails if an option is invalid.
+func NewWithOptions(opts ...Option) (CSITranslator, error) {
+	t := CSITranslator{plugins: make(map[string]plugins.InTreePlugin, len(inTreePlugins))}
+	for driverName, curPlugin := range inTreePlugins {
+		t.plugins[driverName] = curPlugin
+	}
+	for _, opt := range opts {
+		if err := opt(&t); err != nil {
+			return CSITranslator{}, err
+		}
+	}
+	return t, nil
+}
+
+// registerPlugin makes plugin translate volumes to the CSI driver driverName.
+// Plugins of other CSI drivers, including the default ones, cannot be
+// overridden.
+func (t *CSITranslator) registerPlugin(driverName string, plugin plugins.InTreePlugin) error {
+	if curPlugin, ok := t.plugins[driverName]; ok {
+		return fmt.Errorf("CSI driver %s is already registered for in-tree plugin %s", driverName, curPlugin.GetInTreePluginName())
+	}
+	t.plugins[driverName] = plugin
+	return nil
+}
+
+// getInTreePlugins returns the in-tree plugins known to this translator keyed
+// by the name of the CSI driver superseding them
+func (t CSITranslator) getInTreePlugins() map[string]plugins.InTreePlugin {
+	if t.plugins == nil {
+		return inTreePlugins
+	}
+	return t.plugins
+}
+
 // TranslateInTreeStorageClassToCSI takes in-tree Storage Class
 // and translates it to a set of parameters consumable by CSI plugin
-func (CSITranslator) TranslateInTreeStorageClassToCSI(inTreePluginName string, sc *storage.StorageClass) (*storage.StorageClass, error) {
+func (t CSITranslator) TranslateInTreeStorageClassToCSI(inTreePluginName string, sc *storage.StorageClass) (*storage.StorageClass, error) {
 	newSC := sc.DeepCopy()
-	for _, curPlugin := range inTreePlugins {
+	for _, curPlugin := range t.getInTreePlugins() {
+		if inTreePluginName == curPlugin.GetInTreePluginName() {
+			return curPlugin.TranslateInTreeStorageClassToCSI(newSC)
+		}
+	}
+	for _, curPlugin := range noCSIEquivalentPlugins {
 		if inTreePluginName == curPlugin.GetInTreePluginName() {
 			return curPlugin.TranslateInTreeStorageClassToCSI(newSC)
 		}
@@ -61,14 +180,28 @@ func (CSITranslator) TranslateInTreeStorageClassToCSI(inTreePluginName string, s
 	return nil, fmt.Errorf("could not find in-tree storage class parameter translation logic for %#v", inTreePluginName)
 }
 
+// TranslateCSIStorageClassToInTree takes a Storage Class of a CSI driver and
+// translates its parameters back to ones consumable by the in-tree plugin
+func (t CSITranslator) TranslateCSIStorageClassToInTree(csiPluginName string, sc *storage.StorageClass) (*storage.StorageClass, error) {
+	curPlugin, ok := t.getInTreePlugins()[csiPluginName]
+	if !ok {
+		return nil, fmt.Errorf("could not find in-tree plugin for CSI driver %#v", csiPluginName)
+	}
+	scTranslator, ok := curPlugin.(plugins.CSIStorageClassTranslator)
+	if !ok {
+		return nil, fmt.Errorf("could not find CSI storage class parameter translation logic for %#v", csiPluginName)
+	}
+	return scTranslator.TranslateCSIStorageClassToInTree(sc.DeepCopy())
+}
+
 // TranslateInTreeInlineVolumeToCSI takes a inline volume and will translate
 // the in-tree volume source to a CSIPersistentVolumeSource (wrapped in a PV)
 // if the translation logic has been implemented.
-func (CSITranslator) TranslateInTreeInlineVolumeToCSI(volume *v1.Volume, podNamespace string) (*v1.PersistentVolume, error) {
+func (t CSITranslator) TranslateInTreeInlineVolumeToCSI(volume *v1.Volume, podNamespace string) (*v1.PersistentVolume, error) {
 	if volume == nil {
 		return nil, fmt.Errorf("persistent volume was nil")
 	}
-	for _, curPlugin := range inTreePlugins {
+	for _, curPlugin := range t.getInTreePlugins() {
 		if curPlugin.CanSupportInline(volume) {
 			pv, err := curPlugin.TranslateInTreeInlineVolumeToCSI(volume, podNamespace)
 			if err != nil {
@@ -86,6 +219,11 @@ func (CSITranslator) TranslateInTreeInlineVolumeToCSI(volume *v1.Volume, podName
 			return pv, nil
 		}
 	}
+	for _, curPlugin := range noCSIEquivalentPlugins {
+		if curPlugin.CanSupportInline(volume) {
+			return curPlugin.TranslateInTreeInlineVolumeToCSI(volume, podNamespace)
+		}
+	}
 	return nil, fmt.Errorf("could not find in-tree plugin translation logic for %#v", volume.Name)
 }
 
@@ -93,12 +231,25 @@ func (CSITranslator) TranslateInTreeInlineVolumeToCSI(volume *v1.Volume, podName
 // the in-tree source to a CSI Source if the translation logic
 // has been implemented. The input persistent volume will not
 // be modified
-func (CSITranslator) TranslateInTreePVToCSI(pv *v1.PersistentVolume) (*v1.PersistentVolume, error) {
+func (t CSITranslator) TranslateInTreePVToCSI(pv *v1.PersistentVolume) (*v1.PersistentVolume, error) {
 	if pv == nil {
 		return nil, errors.New("persistent volume was nil")
 	}
+	if cachedPV, ok := t.cache.get(pv); ok {
+		return cachedPV, nil
+	}
 	copiedPV := pv.DeepCopy()
-	for _, curPlugin := range inTreePlugins {
+	for _, curPlugin := range t.getInTreePlugins() {
+		if curPlugin.CanSupport(copiedPV) {
+			translatedPV, err := curPlugin.TranslateInTreePVToCSI(copiedPV)
+			if err != nil {
+				return nil, err
+			}
+			t.cache.add(pv, translatedPV)
+			return translatedPV, nil
+		}
+	}
+	for _, curPlugin := range noCSIEquivalentPlugins {
 		if curPlugin.CanSupport(copiedPV) {
 			return curPlugin.TranslateInTreePVToCSI(copiedPV)
 		}
@@ -109,12 +260,12 @@ func (CSITranslator) TranslateInTreePVToCSI(pv *v1.PersistentVolume) (*v1.Persis
 // TranslateCSIPVToInTree takes a PV with a CSI PersistentVolume Source and will translate
 // it to a in-tree Persistent Volume Source for the specific in-tree volume specified
 // by the `Driver` field in the CSI Source. The input PV object will not be modified.
-func (CSITranslator) TranslateCSIPVToInTree(pv *v1.PersistentVolume) (*v1.PersistentVolume, error) {
+func (t CSITranslator) TranslateCSIPVToInTree(pv *v1.PersistentVolume) (*v1.PersistentVolume, error) {
 	if pv == nil || pv.Spec.CSI == nil {
 		return nil, errors.New("CSI persistent volume was nil")
 	}
 	copiedPV := pv.DeepCopy()
-	for driverName, curPlugin := range inTreePlugins {
+	for driverName, curPlugin := range t.getInTreePlugins() {
 		if copiedPV.Spec.CSI.Driver == driverName {
 			return curPlugin.TranslateCSIPVToInTree(copiedPV)
 		}
@@ -124,8 +275,8 @@ func (CSITranslator) TranslateCSIPVToInTree(pv *v1.PersistentVolume) (*v1.Persis
 
 // IsMigratableIntreePluginByName tests whether there is migration logic for the in-tree plugin
 // whose name matches the given name
-func (CSITranslator) IsMigratableIntreePluginByName(inTreePluginName string) bool {
-	for _, curPlugin := range inTreePlugins {
+func (t CSITranslator) IsMigratableIntreePluginByName(inTreePluginName string) bool {
+	for _, curPlugin := range t.getInTreePlugins() {
 		if curPlugin.GetInTreePluginName() == inTreePluginName {
 			return true
 		}
@@ -135,24 +286,24 @@ func (CSITranslator) IsMigratableIntreePluginByName(inTreePluginName string) boo
 
 // IsMigratedCSIDriverByName tests whether there exists an in-tree plugin with logic
 // to migrate to the CSI driver with given name
-func (CSITranslator) IsMigratedCSIDriverByName(csiPluginName string) bool {
-	if _, ok := inTreePlugins[csiPluginName]; ok {
+func (t CSITranslator) IsMigratedCSIDriverByName(csiPluginName string) bool {
+	if _, ok := t.getInTreePlugins()[csiPluginName]; ok {
 		return true
 	}
 	return false
 }
 
 // GetInTreePluginNameFromSpec returns the plugin name
-func (CSITranslator) GetInTreePluginNameFromSpec(pv *v1.PersistentVolume, vol *v1.Volume) (string, error) {
+func (t CSITranslator) GetInTreePluginNameFromSpec(pv *v1.PersistentVolume, vol *v1.Volume) (string, error) {
 	if pv != nil {
-		for _, curPlugin := range inTreePlugins {
+		for _, curPlugin := range t.getInTreePlugins() {
 			if curPlugin.CanSupport(pv) {
 				return curPlugin.GetInTreePluginName(), nil
 			}
 		}
 		return "", fmt.Errorf("could not find in-tree plugin name from persistent volume %v", pv)
 	} else if vol != nil {
-		for _, curPlugin := range inTreePlugins {
+		for _, curPlugin := range t.getInTreePlugins() {
 			if curPlugin.CanSupportInline(vol) {
 				return curPlugin.GetInTreePluginName(), nil
 			}
@@ -165,8 +316,8 @@ func (CSITranslator) GetInTreePluginNameFromSpec(pv *v1.PersistentVolume, vol *v
 
 // GetCSINameFromInTreeName returns the name of a CSI driver that supersedes the
 // in-tree plugin with the given name
-func (CSITranslator) GetCSINameFromInTreeName(pluginName string) (string, error) {
-	for csiDriverName, curPlugin := range inTreePlugins {
+func (t CSITranslator) GetCSINameFromInTreeName(pluginName string) (string, error) {
+	for csiDriverName, curPlugin := range t.getInTreePlugins() {
 		if curPlugin.GetInTreePluginName() == pluginName {
 			return csiDriverName, nil
 		}
@@ -176,16 +327,16 @@ func (CSITranslator) GetCSINameFromInTreeName(pluginName string) (string, error)
 
 // GetInTreeNameFromCSIName returns the name of the in-tree plugin superseded by
 // a CSI driver with the given name
-func (CSITranslator) GetInTreeNameFromCSIName(pluginName string) (string, error) {
-	if plugin, ok := inTreePlugins[pluginName]; ok {
+func (t CSITranslator) GetInTreeNameFromCSIName(pluginName string) (string, error) {
+	if plugin, ok := t.getInTreePlugins()[pluginName]; ok {
 		return plugin.GetInTreePluginName(), nil
 	}
 	return "", fmt.Errorf("could not find In-Tree driver name for CSI plugin %v", pluginName)
 }
 
 // IsPVMigratable tests whether there is migration logic for the given Persistent Volume
-func (CSITranslator) IsPVMigratable(pv *v1.PersistentVolume) bool {
-	for _, curPlugin := range inTreePlugins {
+func (t CSITranslator) IsPVMigratable(pv *v1.PersistentVolume) bool {
+	for _, curPlugin := range t.getInTreePlugins() {
 		if curPlugin.CanSupport(pv) {
 			return true
 		}
@@ -194,8 +345,8 @@ func (CSITranslator) IsPVMigratable(pv *v1.PersistentVolume) bool {
 }
 
 // IsInlineMigratable tests whether there is Migration logic for the given Inline Volume
-func (CSITranslator) IsInlineMigratable(vol *v1.Volume) bool {
-	for _, curPlugin := range inTreePlugins {
+func (t CSITranslator) IsInlineMigratable(vol *v1.Volume) bool {
+	for _, curPlugin := range t.getInTreePlugins() {
 		if curPlugin.CanSupportInline(vol) {
 			return true
 		}
@@ -204,9 +355,71 @@ func (CSITranslator) IsInlineMigratable(vol *v1.Volume) bool {
 }
 
 // RepairVolumeHandle generates a correct volume handle based on node ID information.
-func (CSITranslator) RepairVolumeHandle(driverName, volumeHandle, nodeID string) (string, error) {
-	if plugin, ok := inTreePlugins[driverName]; ok {
+func (t CSITranslator) RepairVolumeHandle(driverName, volumeHandle, nodeID string) (string, error) {
+	if plugin, ok := t.getInTreePlugins()[driverName]; ok {
 		return plugin.RepairVolumeHandle(volumeHandle, nodeID)
 	}
 	return "", fmt.Errorf("could not find In-Tree driver name for CSI plugin %v", driverName)
 }
+
+// TranslateInTreeResizerNameToCSI returns the name of the CSI driver that takes
+// over volume expansions from the in-tree plugin with the given resizer name.
+// Names of migrated CSI drivers are returned unchanged.
+func (t CSITranslator) TranslateInTreeResizerNameToCSI(resizerName string) (string, error) {
+	if t.IsMigratedCSIDriverByName(resizerName) {
+		return resizerName, nil
+	}
+	return t.GetCSINameFromInTreeName(resizerName)
+}
+
+// TranslateCSIResizerNameToInTree returns the name of the in-tree plugin that
+// takes over volume expansions from the CSI driver with the given resizer name.
+// Names of migratable in-tree plugins are returned unchanged.
+func (t CSITranslator) TranslateCSIResizerNameToInTree(resizerName string) (string, error) {
+	if t.IsMigratableIntreePluginByName(resizerName) {
+		return resizerName, nil
+	}
+	return t.GetInTreeNameFromCSIName(resizerName)
+}
+
+// TranslateInTreePVCResizerToCSI rewrites the resizer annotation of a PVC with
+// an in-flight expansion from the in-tree plugin to the CSI driver, so the
+// expansion is picked up after migration. Resize status conditions do not
+// depend on the resizer and are kept as they are. The input PVC will not be
+// modified.
+func (t CSITranslator) TranslateInTreePVCResizerToCSI(pvc *v1.PersistentVolumeClaim) (*v1.PersistentVolumeClaim, error) {
+	if pvc == nil {
+		return nil, errors.New("persistent volume claim was nil")
+	}
+	copiedPVC := pvc.DeepCopy()
+	resizerName, ok := copiedPVC.Annotations[ResizerAnnotationKey]
+	if !ok {
+		return copiedPVC, nil
+	}
+	csiResizerName, err := t.TranslateInTreeResizerNameToCSI(resizerName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to translate resizer of persistent volume claim %s/%s: %v", copiedPVC.Namespace, copiedPVC.Name, err)
+	}
+	copiedPVC.Annotations[ResizerAnnotationKey] = csiResizerName
+	return copiedPVC, nil
+}
+
+// TranslateCSIPVCResizerToInTree rewrites the resizer annotation of a PVC with
+// an in-flight expansion from the CSI driver to the in-tree plugin, so the
+// expansion is picked up after a rollback. The input PVC will not be modified.
+func (t CSITranslator) TranslateCSIPVCResizerToInTree(pvc *v1.PersistentVolumeClaim) (*v1.PersistentVolumeClaim, error) {
+	if pvc == nil {
+		return nil, errors.New("persistent volume claim was nil")
+	}
+	copiedPVC := pvc.DeepCopy()
+	resizerName, ok := copiedPVC.Annotations[ResizerAnnotationKey]
+	if !ok {
+		return copiedPVC, nil
+	}
+	inTreeResizerName, err := t.TranslateCSIResizerNameToInTree(resizerName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to translate resizer of persistent volume claim %s/%s: %v", copiedPVC.Namespace, copiedPVC.Name, err)
+	}
+	copiedPVC.Annotations[ResizerAnnotationKey] = inTreeResizerName
+	return copiedPVC, nil
+}
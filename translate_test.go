@@ -17,11 +17,14 @@ limitations under the License.
 package csitranslation
 
 import (
+	"errors"
 	"fmt"
 	"reflect"
 	"testing"
 
 	v1 "k8s.io/api/core/v1"
+	storage "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/uuid"
 	"k8s.io/csi-translation-lib/plugins"
@@ -501,4 +504,396 @@ func TestPluginNameMappings(t *testing.T) {
 	}
 }
 
+func TestGlusterfsCSIDriverOption(t *testing.T) {
+	const driverName = "glusterfs.csi.example.com"
+	pv := &v1.PersistentVolume{
+		Spec: v1.PersistentVolumeSpec{
+			PersistentVolumeSource: v1.PersistentVolumeSource{
+				Glusterfs: &v1.GlusterfsPersistentVolumeSource{
+					EndpointsName: "glusterfs-cluster",
+					Path:          "kube_vol",
+				},
+			},
+		},
+	}
+
+	ctl := New()
+	if ctl.IsPVMigratable(pv) {
+		t.Errorf("Expected GlusterFS PV not to be migratable without a configured CSI driver")
+	}
+	_, err := ctl.TranslateInTreePVToCSI(pv)
+	var noCSIErr *plugins.ErrNoCSIEquivalent
+	if !errors.As(err, &noCSIErr) {
+		t.Fatalf("Expected ErrNoCSIEquivalent, got: %v", err)
+	}
+	if noCSIErr.Details["path"] != "kube_vol" {
+		t.Errorf("Expected path in error details, got: %v", noCSIErr.Details)
+	}
+
+	ctl, err = NewWithOptions(WithGlusterfsCSIDriverName(""))
+	if err != nil {
+		t.Fatalf("Error when creating translator: %v", err)
+	}
+	if ctl.IsMigratableIntreePluginByName(plugins.GlusterfsInTreePluginName) {
+		t.Errorf("Expected GlusterFS not to be migratable with an empty CSI driver name")
+	}
+	if _, err := ctl.GetCSINameFromInTreeName(plugins.GlusterfsInTreePluginName); err == nil {
+		t.Errorf("Expected no CSI driver name for GlusterFS with an empty CSI driver name")
+	}
+
+	ctl, err = NewWithOptions(WithGlusterfsCSIDriverName(driverName))
+	if err != nil {
+		t.Fatalf("Error when creating translator: %v", err)
+	}
+	if !ctl.IsPVMigratable(pv) {
+		t.Errorf("Expected GlusterFS PV to be migratable with a configured CSI driver")
+	}
+	csiPV, err := ctl.TranslateInTreePVToCSI(pv)
+	if err != nil {
+		t.Fatalf("Error when translating to CSI: %v", err)
+	}
+	if csiPV.Spec.CSI == nil || csiPV.Spec.CSI.Driver != driverName {
+		t.Errorf("Expected CSI source with driver %s, got: %v", driverName, csiPV.Spec.CSI)
+	}
+	newPV, err := ctl.TranslateCSIPVToInTree(csiPV)
+	if err != nil {
+		t.Fatalf("Error when translating CSI Source to in tree volume: %v", err)
+	}
+	if !reflect.DeepEqual(newPV, pv) {
+		t.Errorf("Volumes after translation and back not equal:\n\nOriginal Volume: %#v\n\nRound-trip Volume: %#v", pv, newPV)
+	}
+	inTreePluginName, err := ctl.GetInTreeNameFromCSIName(driverName)
+	if err != nil || inTreePluginName != plugins.GlusterfsInTreePluginName {
+		t.Errorf("Expected %s to map to %s, got %s (err: %v)", driverName, plugins.GlusterfsInTreePluginName, inTreePluginName, err)
+	}
+}
+
+func TestFlexVolumeDriversOption(t *testing.T) {
+	var transform plugins.FlexVolumeOptionsTransformFn = func(options map[string]string) (string, map[string]string, error) {
+		return options["volumeID"], nil, nil
+	}
+	var inverseTransform plugins.FlexVolumeOptionsInverseTransformFn = func(volumeHandle string, attributes map[string]string) (map[string]string, error) {
+		return map[string]string{"volumeID": volumeHandle}, nil
+	}
+	ctl, err := NewWithOptions(WithFlexVolumeDrivers(map[string]string{
+		"example/lvm": "lvm.csi.example.com",
+		"example/nfs": "nfs.csi.example.com",
+	}, transform, inverseTransform))
+	if err != nil {
+		t.Fatalf("Error when creating translator: %v", err)
+	}
+
+	pv := &v1.PersistentVolume{
+		Spec: v1.PersistentVolumeSpec{
+			PersistentVolumeSource: v1.PersistentVolumeSource{
+				FlexVolume: &v1.FlexPersistentVolumeSource{
+					Driver:  "example/nfs",
+					Options: map[string]string{"volumeID": "export1"},
+				},
+			},
+		},
+	}
+	csiPV, err := ctl.TranslateInTreePVToCSI(pv)
+	if err != nil {
+		t.Fatalf("Error when translating to CSI: %v", err)
+	}
+	if csiPV.Spec.CSI.Driver != "nfs.csi.example.com" || csiPV.Spec.CSI.VolumeHandle != "export1" {
+		t.Errorf("Unexpected CSI source: %v", csiPV.Spec.CSI)
+	}
+	csiPluginName, err := ctl.GetCSINameFromInTreeName("flexvolume-example/lvm")
+	if err != nil || csiPluginName != "lvm.csi.example.com" {
+		t.Errorf("Expected flexvolume-example/lvm to map to lvm.csi.example.com, got %s (err: %v)", csiPluginName, err)
+	}
+	if New().IsPVMigratable(pv) {
+		t.Errorf("Expected FlexVolume PV not to be migratable without a configured mapping")
+	}
+
+	invalidMappings := []struct {
+		name             string
+		driverNames      map[string]string
+		transform        plugins.FlexVolumeOptionsTransformFn
+		inverseTransform plugins.FlexVolumeOptionsInverseTransformFn
+	}{
+		{
+			name: "two FlexVolume drivers mapped to the same CSI driver",
+			driverNames: map[string]string{
+				"a/lvm": "lvm.csi.example.com",
+				"b/lvm": "lvm.csi.example.com",
+			},
+			transform:        transform,
+			inverseTransform: inverseTransform,
+		},
+		{
+			name:             "FlexVolume driver mapped to a built-in CSI driver",
+			driverNames:      map[string]string{"example/pd": plugins.GCEPDDriverName},
+			transform:        transform,
+			inverseTransform: inverseTransform,
+		},
+		{
+			name:             "FlexVolume driver mapped to an empty CSI driver name",
+			driverNames:      map[string]string{"example/lvm": ""},
+			transform:        transform,
+			inverseTransform: inverseTransform,
+		},
+		{
+			name:             "no transform",
+			driverNames:      map[string]string{"example/lvm": "lvm.csi.example.com"},
+			inverseTransform: inverseTransform,
+		},
+		{
+			name:        "no inverse transform",
+			driverNames: map[string]string{"example/lvm": "lvm.csi.example.com"},
+			transform:   transform,
+		},
+	}
+	for _, test := range invalidMappings {
+		t.Logf("Testing %v", test.name)
+		if _, err := NewWithOptions(WithFlexVolumeDrivers(test.driverNames, test.transform, test.inverseTransform)); err == nil {
+			t.Errorf("Expected error, but did not get one.")
+		}
+	}
+}
+
+func TestResizerNameTranslation(t *testing.T) {
+	testCases := []struct {
+		name        string
+		resizerName string
+		expCSIName  string
+		expErr      bool
+	}{
+		{
+			name:        "in-tree resizer",
+			resizerName: plugins.GCEPDInTreePluginName,
+			expCSIName:  plugins.GCEPDDriverName,
+		},
+		{
+			name:        "CSI resizer",
+			resizerName: plugins.AWSEBSDriverName,
+			expCSIName:  plugins.AWSEBSDriverName,
+		},
+		{
+			name:        "unknown resizer",
+			resizerName: "kubernetes.io/unknown",
+			expErr:      true,
+		},
+	}
+	for _, test := range testCases {
+		t.Logf("Testing %v", test.name)
+		ctl := New()
+		csiName, err := ctl.TranslateInTreeResizerNameToCSI(test.resizerName)
+		if err != nil && !test.expErr {
+			t.Errorf("Did not expect error but got: %v", err)
+		}
+		if err == nil && test.expErr {
+			t.Errorf("Expected error, but did not get one.")
+		}
+		if csiName != test.expCSIName {
+			t.Errorf("Got resizer name %s, expected %s", csiName, test.expCSIName)
+		}
+	}
+}
+
+func TestPVCResizerTranslation(t *testing.T) {
+	pvc := &v1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "claim",
+			Namespace:   "default",
+			Annotations: map[string]string{ResizerAnnotationKey: plugins.AzureDiskInTreePluginName},
+		},
+		Status: v1.PersistentVolumeClaimStatus{
+			Conditions: []v1.PersistentVolumeClaimCondition{
+				{
+					Type:   v1.PersistentVolumeClaimResizing,
+					Status: v1.ConditionTrue,
+				},
+			},
+		},
+	}
+
+	ctl := New()
+	csiPVC, err := ctl.TranslateInTreePVCResizerToCSI(pvc)
+	if err != nil {
+		t.Fatalf("Error when translating PVC resizer to CSI: %v", err)
+	}
+	if resizer := csiPVC.Annotations[ResizerAnnotationKey]; resizer != plugins.AzureDiskDriverName {
+		t.Errorf("Got resizer %s, expected %s", resizer, plugins.AzureDiskDriverName)
+	}
+	if !reflect.DeepEqual(csiPVC.Status, pvc.Status) {
+		t.Errorf("Expected resize conditions to be kept, got: %v", csiPVC.Status)
+	}
+	if resizer := pvc.Annotations[ResizerAnnotationKey]; resizer != plugins.AzureDiskInTreePluginName {
+		t.Errorf("Input PVC was modified, resizer is %s", resizer)
+	}
+
+	inTreePVC, err := ctl.TranslateCSIPVCResizerToInTree(csiPVC)
+	if err != nil {
+		t.Fatalf("Error when translating PVC resizer to in-tree: %v", err)
+	}
+	if !reflect.DeepEqual(inTreePVC, pvc) {
+		t.Errorf("PVCs after translation and back not equal:\n\nOriginal PVC: %#v\n\nRound-trip PVC: %#v", pvc, inTreePVC)
+	}
+
+	unknownPVC := pvc.DeepCopy()
+	unknownPVC.Annotations[ResizerAnnotationKey] = "kubernetes.io/unknown"
+	if _, err := ctl.TranslateInTreePVCResizerToCSI(unknownPVC); err == nil {
+		t.Errorf("Expected error for unknown resizer, but did not get one.")
+	}
+}
+
+func TestExpansionMetadataPreserved(t *testing.T) {
+	allowVolumeExpansion := true
+	testCases := []struct {
+		name             string
+		inTreePluginName string
+		params           map[string]string
+	}{
+		{
+			name:             "GCE PD",
+			inTreePluginName: plugins.GCEPDInTreePluginName,
+		},
+		{
+			name:             "AWS EBS",
+			inTreePluginName: plugins.AWSEBSInTreePluginName,
+		},
+		{
+			name:             "Azure Disk",
+			inTreePluginName: plugins.AzureDiskInTreePluginName,
+		},
+		{
+			name:             "Azure File",
+			inTreePluginName: plugins.AzureFileInTreePluginName,
+		},
+		{
+			name:             "Cinder",
+			inTreePluginName: plugins.CinderInTreePluginName,
+		},
+		{
+			name:             "vSphere",
+			inTreePluginName: plugins.VSphereInTreePluginName,
+		},
+		{
+			name:             "Portworx",
+			inTreePluginName: plugins.PortworxVolumePluginName,
+		},
+		{
+			name:             "RBD",
+			inTreePluginName: plugins.RBDVolumePluginName,
+			params: map[string]string{
+				"monitors":        "10.70.53.126:6789",
+				"adminSecretName": "ceph-secret",
+			},
+		},
+	}
+	for _, test := range testCases {
+		t.Logf("Testing %v", test.name)
+		ctl := New()
+		sc := &storage.StorageClass{
+			Parameters:           test.params,
+			AllowVolumeExpansion: &allowVolumeExpansion,
+		}
+		csiSC, err := ctl.TranslateInTreeStorageClassToCSI(test.inTreePluginName, sc)
+		if err != nil {
+			t.Fatalf("Error when translating storage class to CSI: %v", err)
+		}
+		if csiSC.AllowVolumeExpansion == nil || !*csiSC.AllowVolumeExpansion {
+			t.Errorf("Expected allowVolumeExpansion to be preserved, got: %v", csiSC.AllowVolumeExpansion)
+		}
+	}
+
+	pv := makeGCEPDPV(kubernetesGATopologyLabels, nil /*topology*/)
+	pv.Spec.Capacity = v1.ResourceList{v1.ResourceStorage: resource.MustParse("10Gi")}
+	csiPV, err := New().TranslateInTreePVToCSI(pv)
+	if err != nil {
+		t.Fatalf("Error when translating to CSI: %v", err)
+	}
+	if !reflect.DeepEqual(csiPV.Spec.Capacity, pv.Spec.Capacity) {
+		t.Errorf("Expected capacity %v to be preserved, got: %v", pv.Spec.Capacity, csiPV.Spec.Capacity)
+	}
+}
+
 // TODO: test for not modifying the original PV.
+
+func TestStorageClassRoundTrip(t *testing.T) {
+	testCases := []struct {
+		name     string
+		driver   string
+		inTreeSC *storage.StorageClass
+	}{
+		{
+			name:   "AWS EBS encrypted",
+			driver: plugins.AWSEBSDriverName,
+			inTreeSC: &storage.StorageClass{
+				Parameters: map[string]string{
+					"type":      "gp2",
+					"fstype":    "ext4",
+					"iopsPerGB": "10",
+					"encrypted": "true",
+					"kmsKeyId":  "arn:aws:kms:us-west-2:111122223333:key/1234abcd-12ab-34cd-56ef-1234567890ab",
+				},
+				AllowedTopologies: []v1.TopologySelectorTerm{
+					{
+						MatchLabelExpressions: []v1.TopologySelectorLabelRequirement{
+							{
+								Key:    v1.LabelTopologyZone,
+								Values: []string{"us-west-2a"},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:   "Azure Disk encrypted",
+			driver: plugins.AzureDiskDriverName,
+			inTreeSC: &storage.StorageClass{
+				Parameters: map[string]string{
+					"skuName":             "Premium_LRS",
+					"kind":                "managed",
+					"cachingMode":         "ReadOnly",
+					"diskEncryptionSetID": "/subscriptions/12/resourceGroups/23/providers/Microsoft.Compute/diskEncryptionSets/des",
+				},
+			},
+		},
+		{
+			name:   "GCE PD encrypted",
+			driver: plugins.GCEPDDriverName,
+			inTreeSC: &storage.StorageClass{
+				Parameters: map[string]string{
+					"type":                    "pd-ssd",
+					"fstype":                  "ext4",
+					"disk-encryption-kms-key": "projects/my-project/locations/us-central1/keyRings/my-ring/cryptoKeys/my-key",
+				},
+				AllowedTopologies: []v1.TopologySelectorTerm{
+					{
+						MatchLabelExpressions: []v1.TopologySelectorLabelRequirement{
+							{
+								Key:    v1.LabelTopologyZone,
+								Values: []string{"us-central1-a"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	for _, test := range testCases {
+		t.Logf("Testing %v", test.name)
+		ctl := New()
+		inTreePluginName, err := ctl.GetInTreeNameFromCSIName(test.driver)
+		if err != nil {
+			t.Fatalf("Error when getting in-tree plugin name: %v", err)
+		}
+		csiSC, err := ctl.TranslateInTreeStorageClassToCSI(inTreePluginName, test.inTreeSC)
+		if err != nil {
+			t.Fatalf("Error when translating storage class to CSI: %v", err)
+		}
+		inTreeSC, err := ctl.TranslateCSIStorageClassToInTree(test.driver, csiSC)
+		if err != nil {
+			t.Errorf("Error when translating storage class to in-tree: %v", err)
+			continue
+		}
+		if !reflect.DeepEqual(inTreeSC, test.inTreeSC) {
+			t.Errorf("Storage classes after translation and back not equal:\n\nOriginal: %#v\n\nRound-trip: %#v", test.inTreeSC, inTreeSC)
+		}
+	}
+}